@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	variant "github.com/mumoshu/variant/pkg"
+)
+
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage task outputs cached on disk",
+	Long: `Manage outputs of tasks with the "cache" option, which are stored on disk to be reused across invocations.
+
+Example:
+var cache clear #=> Removes all the cached task outputs
+`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all the task outputs cached on disk",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return variant.ClearCache()
+	},
+}
+
+func init() {
+	CacheCmd.AddCommand(cacheClearCmd)
+}
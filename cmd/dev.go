@@ -79,6 +79,7 @@ func RunE() (variant.Opts, error) {
 
 	opts.ExtraCmds = []*cobra.Command{
 		EnvCmd,
+		CacheCmd,
 		BuildCmd,
 		InitCmd,
 		UtilsCmd,
@@ -134,6 +135,7 @@ func HandleError(err error, opts variant.Opts) (string, int) {
 	args := opts.Args
 	log := opts.Log
 	var msg string
+	status := 1
 	switch cmdErr := err.(type) {
 	case variant.InitError:
 		msg = fmt.Sprintf("%v", err)
@@ -147,6 +149,13 @@ func HandleError(err error, opts variant.Opts) (string, int) {
 		if strings.Trim(cmdErr.Cause, " \n\t") != "" {
 			msg += fmt.Sprintf("\nCaused by: %s", cmdErr.Cause)
 		}
+		if cmdErr.ExitStatus > 0 {
+			status = cmdErr.ExitStatus
+		}
+		if timeoutErr, ok := cmdErr.TimeoutError(); ok {
+			msg += fmt.Sprintf("\nTimed out: %v", timeoutErr)
+			status = variant.TimeoutExitStatus
+		}
 	case variant.InternalError:
 		msg = fmt.Sprintf("%v", err)
 	default:
@@ -157,14 +166,20 @@ func HandleError(err error, opts variant.Opts) (string, int) {
 		}
 		msg = fmt.Sprintf("Unexpected type of error %T: %s", err, err)
 	}
-	return msg, 1
+	return msg, status
 }
 
 func GetStatus(err error, opts variant.Opts) int {
-	switch err.(type) {
+	switch cmdErr := err.(type) {
 	case variant.InitError:
 		return 1
 	case variant.CommandError:
+		if _, ok := cmdErr.TimeoutError(); ok {
+			return variant.TimeoutExitStatus
+		}
+		if cmdErr.ExitStatus > 0 {
+			return cmdErr.ExitStatus
+		}
 		return 1
 	default:
 		// Variant command should produce the command help,
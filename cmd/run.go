@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+
 	variant "github.com/mumoshu/variant/pkg"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -36,6 +38,15 @@ func init() {
 	variant.Register(variant.NewScriptStepLoader())
 	variant.Register(variant.NewOrStepLoader())
 	variant.Register(variant.NewIfStepLoader())
+	variant.Register(variant.NewParallelStepLoader())
+	variant.Register(variant.NewForeachStepLoader())
+	variant.Register(variant.NewSwitchStepLoader())
+	variant.Register(variant.NewUntilStepLoader())
+	variant.Register(variant.NewHTTPStepLoader())
+	variant.Register(variant.NewFileStepLoader())
+	variant.Register(variant.NewAssertStepLoader())
+	variant.Register(variant.NewSetStepLoader())
+	variant.Register(variant.NewConfirmStepLoader())
 }
 
 func Run(taskDef *variant.TaskDef, opts variant.Opts) (map[string]string, error) {
@@ -54,7 +65,10 @@ func Run(taskDef *variant.TaskDef, opts variant.Opts) (map[string]string, error)
 		return nil, err
 	}
 
-	return cobraApp.Run(opts.Args)
+	ctx, stop := variant.WithSignals(context.Background(), opts.Log)
+	defer stop()
+
+	return cobraApp.RunContext(ctx, opts.Args)
 }
 
 func command(commandPath string, taskDef *variant.TaskDef, opts variant.Opts) (*variant.CobraApp, error) {
@@ -91,7 +105,10 @@ func (c *Command) Run(args []string) (string, error) {
 		return "", err
 	}
 
-	results, err := cobraApp.Run(args)
+	ctx, stop := variant.WithSignals(context.Background(), cobraApp.VariantApp.Log)
+	defer stop()
+
+	results, err := cobraApp.RunContext(ctx, args)
 	if err != nil {
 		return "", err
 	}
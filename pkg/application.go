@@ -1,6 +1,7 @@
 package variant
 
 import (
+	"context"
 	"fmt"
 	"github.com/mumoshu/variant/pkg/util/fileutil"
 	"os"
@@ -22,12 +23,13 @@ import (
 	"gopkg.in/yaml.v2"
 	"reflect"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type Application struct {
 	Name                string
 	CommandRelativePath string
-	CachedTaskOutputs   map[string]interface{}
 	ConfigFile          string
 	Verbose             bool
 	Output              string
@@ -38,6 +40,12 @@ type Application struct {
 	InputResolver       InputResolver
 	TaskNamer           *TaskNamer
 	LogToStderr         bool
+	GracePeriod         time.Duration
+	Parallelism         int
+	NoCache             bool
+	Force               bool
+	Yes                 bool
+	PrintEnv            bool
 
 	LogLevel      string
 	LogColorPanic string
@@ -59,6 +67,18 @@ type Application struct {
 	ConfigContexts []string
 	ConfigDirs     []string
 	CommandName    string
+
+	// mutex guards LastOutputs, which is shared across tasks run concurrently
+	mutex *sync.Mutex
+
+	// memo holds outputs of tasks to be reused for the same inputs
+	memo *taskMemo
+
+	// runCtx is cancelled when the command is interrupted
+	runCtx context.Context
+
+	// outputPrefix is prepended to every line printed by tasks run from this copy of the application
+	outputPrefix string
 }
 
 func (p *Application) Color() bool {
@@ -71,6 +91,12 @@ func (p *Application) setGlobalParams() {
 	p.LogToStderr = p.Viper.GetBool("logtostderr")
 	p.Output = p.Viper.GetString("output")
 	p.ConfigFile = p.Viper.GetString("config-file")
+	p.GracePeriod = p.Viper.GetDuration("grace-period")
+	p.Parallelism = p.Viper.GetInt("parallelism")
+	p.NoCache = p.Viper.GetBool("no-cache")
+	p.Force = p.Viper.GetBool("force")
+	p.Yes = p.Viper.GetBool("yes")
+	p.PrintEnv = p.Viper.GetBool("print-env")
 
 	p.LogLevel = p.Viper.GetString("log-level")
 	p.LogColorPanic = p.Viper.GetString("log-color-panic")
@@ -198,26 +224,39 @@ func (p *Application) UpdateLoggingConfiguration() error {
 	return nil
 }
 
-func (p *Application) RunTaskForKeyString(keyStr string, args []string, arguments task.Arguments, scope map[string]interface{}, asInput bool, caller ...*Task) (string, error) {
+func (p *Application) RunTaskForKeyString(runCtx context.Context, keyStr string, args []string, arguments task.Arguments, scope map[string]interface{}, asInput bool, caller ...*Task) (string, error) {
 	taskKey := p.TaskNamer.FromString(fmt.Sprintf("%s.%s", p.Name, keyStr))
-	return p.RunTask(taskKey, args, arguments, scope, asInput, caller...)
+	return p.RunTask(runCtx, taskKey, args, arguments, scope, asInput, caller...)
 }
 
 func (p *Application) Run(taskName TaskName, args []string) error {
 	p.LastRun = taskName.ShortString()
 
-	errMsg, err := p.RunTask(taskName, args, task.NewArguments(), map[string]interface{}{}, false)
+	runCtx := p.runCtx
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+
+	errMsg, err := p.RunTask(runCtx, taskName, args, task.NewArguments(), map[string]interface{}{}, false)
 
 	if err != nil {
-		return CommandError{error: err, TaskName: taskName, Cause: errMsg}
+		cmdErr := CommandError{error: err, TaskName: taskName, Cause: errMsg}
+		if scriptErr, ok := rootCause(err).(ScriptError); ok && scriptErr.ExitStatus > 0 {
+			cmdErr.ExitStatus = scriptErr.ExitStatus
+		}
+		// Exit like shells do when the command was interrupted
+		if sig, ok := signalFromContext(runCtx); ok {
+			cmdErr.ExitStatus = 128 + int(sig)
+		}
+		return cmdErr
 	}
 	return nil
 }
 
-func (p *Application) RunTask(taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, asInput bool, caller ...*Task) (string, error) {
+func (p *Application) RunTask(runCtx context.Context, taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, asInput bool, caller ...*Task) (string, error) {
 	var ctx *logrus.Entry
 
-	if len(caller) == 1 {
+	if len(caller) > 0 {
 		ctx = p.Log.WithFields(logrus.Fields{"app": p.Name, "task": taskName.ShortString(), "caller": caller[0].GetKey().ShortString()})
 	} else {
 		ctx = p.Log.WithFields(logrus.Fields{"app": p.Name, "task": taskName.ShortString()})
@@ -241,12 +280,23 @@ func (p *Application) RunTask(taskName TaskName, args []string, arguments task.A
 		return "", errors.Errorf("no task named `%s` exists", taskName.ShortString())
 	}
 
+	// Confirm before resolving inputs, as doing so may run other tasks
+	if taskDef.Dangerous {
+		confirmed, err := p.confirm(fmt.Sprintf("Task %s is dangerous. Are you sure you want to run it?", taskName.ShortString()), DefaultConfirmAnswer, "")
+		if err != nil {
+			return err.Error(), errors.Wrapf(err, "%s failed running task %s", p.Name, taskName.ShortString())
+		}
+		if !confirmed {
+			return "aborted by user", fmt.Errorf("%s aborted running dangerous task %s", p.Name, taskName.ShortString())
+		}
+	}
+
 	vars := map[string](interface{}){}
 	vars["args"] = args
 	vars["env"] = p.Env
 	vars["cmd"] = p.CommandRelativePath
 
-	inputs, err := p.InheritedInputValuesForTaskKey(taskName, args, arguments, scope, caller...)
+	inputs, err := p.InheritedInputValuesForTaskKey(runCtx, taskName, args, arguments, scope, caller...)
 
 	if err != nil {
 		return "", errors.Wrapf(err, "%s failed running task %s", p.Name, taskName.ShortString())
@@ -305,7 +355,33 @@ func (p *Application) RunTask(taskName TaskName, args []string, arguments task.A
 		return "", errors.Wrapf(err, "failed to initialize task runner")
 	}
 
-	output, error := taskRunner.Run(p, asInput, caller...)
+	run := func() (string, error) {
+		return taskRunner.Run(runCtx, p, asInput, caller...)
+	}
+
+	if taskDef.Cache.persistent() {
+		run = p.withPersistentCache(run, taskName, taskDef, taskTemplate, vars, asInput, ctx)
+	}
+
+	var output string
+	var error error
+
+	if taskDef.Cache.enabled(asInput) {
+		key, err := taskMemoKey(taskName, vars)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed computing cache key for task %s", taskName.ShortString())
+		}
+
+		var hit bool
+		output, hit, error = p.memo.do(runCtx, key, run)
+		if hit {
+			ctx.Debugf("app reused the cached output of task %s for the same inputs: %s", taskName.ShortString(), key)
+			// A task run as a step prints its output, so the reused output is printed too, as if the task was run again
+			p.replayOutput(output, asInput)
+		}
+	} else {
+		output, error = run()
+	}
 
 	ctx.Debugf("app received output from task %s: %s", taskName.ShortString(), output)
 
@@ -313,21 +389,80 @@ func (p *Application) RunTask(taskName TaskName, args []string, arguments task.A
 		error = errors.Wrapf(error, "%s failed running task %s", p.Name, taskName.ShortString())
 	}
 
+	p.mutex.Lock()
 	if p.LastOutputs == nil {
 		p.LastOutputs = map[string]string{}
 	}
 	p.LastOutputs[taskName.ShortString()] = output
+	p.mutex.Unlock()
 
 	ctx.Debugf("app finished running task %s", taskName.ShortString())
 
 	return output, error
 }
 
-func (p Application) InheritedInputValuesForTaskKey(taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, caller ...*Task) (map[string]interface{}, error) {
+// withPersistentCache makes the task reuse its output stored on disk by a previous run with the same inputs, environment and cache key
+func (p *Application) withPersistentCache(run func() (string, error), taskName TaskName, taskDef *Task, taskTemplate *TaskTemplate, vars map[string]interface{}, asInput bool, ctx *logrus.Entry) func() (string, error) {
+	return func() (string, error) {
+		key, err := taskTemplate.Render(taskDef.Cache.Key, "cache.key")
+		if err != nil {
+			return "", errors.Wrapf(err, "failed rendering cache key of task %s", taskName.ShortString())
+		}
+
+		cache := taskOutputCache{dir: CacheDir}
+
+		path, err := cache.path(taskName, vars, p.Env, key)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed computing cache key for task %s", taskName.ShortString())
+		}
+
+		if p.NoCache {
+			ctx.Debugf("app ignored the output of task %s stored on disk due to --no-cache", taskName.ShortString())
+		} else {
+			output, hit, err := cache.get(path, taskDef.Cache.TTL)
+			if err != nil {
+				ctx.Warnf("app ignored the broken output of task %s stored on disk: %v", taskName.ShortString(), err)
+			} else if hit {
+				ctx.Debugf("app reused the output of task %s stored on disk: %s", taskName.ShortString(), path)
+				p.replayOutput(output, asInput)
+				return output, nil
+			}
+		}
+
+		output, err := run()
+		if err != nil {
+			return output, err
+		}
+
+		if err := cache.put(path, output); err != nil {
+			ctx.Warnf("app failed storing the output of task %s on disk: %v", taskName.ShortString(), err)
+		}
+
+		return output, nil
+	}
+}
+
+// replayOutput prints the cached output of the task as if the task was run, unless the task is run as an input
+func (p *Application) replayOutput(output string, asInput bool) {
+	if asInput || output == "" {
+		return
+	}
+
+	var prefix string
+	if p.outputPrefix != "" {
+		prefix = fmt.Sprintf("[%s] ", p.outputPrefix)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fmt.Fprint(os.Stdout, prefix+line+"\n")
+	}
+}
+
+func (p Application) InheritedInputValuesForTaskKey(runCtx context.Context, taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, caller ...*Task) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 
 	for k, _ := range taskName.Components {
-		direct, err := p.DirectInputValuesForTaskKey(TaskName{Components: taskName.Components[:k+1]}, args, arguments, scope, caller...)
+		direct, err := p.DirectInputValuesForTaskKey(runCtx, TaskName{Components: taskName.Components[:k+1]}, args, arguments, scope, caller...)
 		if err != nil {
 			return nil, errors.Wrapf(err, "missing input for task `%s`", taskName.ShortString())
 		}
@@ -543,12 +678,10 @@ func ensureType(raw interface{}, tpe string) (interface{}, bool) {
 	return nil, false
 }
 
-func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, caller ...*Task) (map[string]interface{}, error) {
-	var errs *multierror.Error
-
+func (p Application) DirectInputValuesForTaskKey(runCtx context.Context, taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, caller ...*Task) (map[string]interface{}, error) {
 	var ctx *logrus.Entry
 
-	if len(caller) == 1 {
+	if len(caller) > 0 {
 		ctx = p.Log.WithFields(logrus.Fields{"app": p.Name, "caller": caller[0].Name.ShortString(), "task": taskName.ShortString()})
 	} else {
 		ctx = p.Log.WithFields(logrus.Fields{"app": p.Name, "task": taskName.ShortString()})
@@ -570,7 +703,16 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 		return nil, errors.Errorf("%s has no task named `%s`", p.Name, taskName)
 	}
 
-	for _, input := range currentTask.ResolvedInputs {
+	var mutex sync.Mutex
+
+	parallelism := p.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	resolve := func(input *Input) error {
+		var errs *multierror.Error
+
 		ctx.Debugf("task `%s` depends on input %s", taskName, input.ShortName())
 
 		var tmplOrStaticVal interface{}
@@ -584,7 +726,7 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 			if str, err := arguments.GetString(input.Name); err == nil && str != "" {
 				tmplOrStaticVal, err = p.parseSupportedValueFromString(str, input.TypeName())
 				if err != nil {
-					return nil, err
+					return err
 				}
 			} else {
 				errs = multierror.Append(errs, fmt.Errorf("no value for argument `%s`", input.Name))
@@ -595,7 +737,7 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 			if str, err := arguments.GetString(input.ShortName()); err == nil && str != "" {
 				tmplOrStaticVal, err = p.parseSupportedValueFromString(str, input.TypeName())
 				if err != nil {
-					return nil, err
+					return err
 				}
 			} else {
 				errs = multierror.Append(errs, fmt.Errorf("no value for argument `%s`", input.ShortName()))
@@ -638,69 +780,67 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 		// Missed all the value sources(default, args, params, options)
 		pathComponents := strings.Split(input.Name, ".")
 		if tmplOrStaticVal == nil {
-			var err error
-			tmplOrStaticVal, err = maputil.GetValueAtPath(p.CachedTaskOutputs, pathComponents)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-			if tmplOrStaticVal == nil {
-				args := arguments.GetSubOrEmpty(input.Name)
-				var output string
-				output, err = p.RunTask(inTaskName, []string{}, args, map[string]interface{}{}, true, currentTask)
-				if output != "" {
-					tmplOrStaticVal = output
+			app := p
+			if parallelism > 1 {
+				// Tells outputs from producer tasks run concurrently apart
+				app.outputPrefix = input.ShortName()
+				if p.outputPrefix != "" {
+					app.outputPrefix = fmt.Sprintf("%s/%s", p.outputPrefix, input.ShortName())
 				}
-				if err != nil {
-					ctx.Debugf("task %#v failed. output was %#v(%T)", inTaskName, tmplOrStaticVal, tmplOrStaticVal)
-					ctx.Debug("looking for a default value")
-					// Check if any default value is given
-					if tmplOrStaticVal == nil {
-						if input.Default != nil {
-							switch input.TypeName() {
-							case "string":
-								tmplOrStaticVal = input.DefaultAsString()
-							case "integer":
-								tmplOrStaticVal = input.DefaultAsInt()
-							case "boolean":
-								tmplOrStaticVal = input.DefaultAsBool()
-							case "array":
-								v, err := input.DefaultAsArray()
-								if err != nil {
-									return nil, errors.Wrapf(err, "failed to parse default value as array: %v", input.Default)
-								}
-								tmplOrStaticVal = v
-							case "object":
-								v, err := input.DefaultAsObject()
-								if err != nil {
-									return nil, errors.Wrapf(err, "failed to parse default value as map: %v", input.Default)
-								}
-								tmplOrStaticVal = v
-							default:
-								return nil, fmt.Errorf("unsupported input type `%s` found. the type should be one of: string, integer, boolean", input.TypeName())
+			}
+			args := arguments.GetSubOrEmpty(input.Name)
+			output, err := app.RunTask(runCtx, inTaskName, []string{}, args, map[string]interface{}{}, true, currentTask)
+			if output != "" {
+				tmplOrStaticVal = output
+			}
+			if err != nil {
+				ctx.Debugf("task %#v failed. output was %#v(%T)", inTaskName, tmplOrStaticVal, tmplOrStaticVal)
+				ctx.Debug("looking for a default value")
+				// Check if any default value is given
+				if tmplOrStaticVal == nil {
+					if input.Default != nil {
+						switch input.TypeName() {
+						case "string":
+							tmplOrStaticVal = input.DefaultAsString()
+						case "integer":
+							tmplOrStaticVal = input.DefaultAsInt()
+						case "boolean":
+							tmplOrStaticVal = input.DefaultAsBool()
+						case "array":
+							v, err := input.DefaultAsArray()
+							if err != nil {
+								return errors.Wrapf(err, "failed to parse default value as array: %v", input.Default)
 							}
-							ctx.Debugf("got %v(%T) from default value %s(%T)", tmplOrStaticVal, tmplOrStaticVal, input.Default, input.Default)
-						} else if input.Name == "env" {
-							tmplOrStaticVal = ""
-						} else {
-							errs = multierror.Append(errs, fmt.Errorf("no default value defined for input `%s`", input.Name))
+							tmplOrStaticVal = v
+						case "object":
+							v, err := input.DefaultAsObject()
+							if err != nil {
+								return errors.Wrapf(err, "failed to parse default value as map: %v", input.Default)
+							}
+							tmplOrStaticVal = v
+						default:
+							return fmt.Errorf("unsupported input type `%s` found. the type should be one of: string, integer, boolean", input.TypeName())
 						}
+						ctx.Debugf("got %v(%T) from default value %s(%T)", tmplOrStaticVal, tmplOrStaticVal, input.Default, input.Default)
+					} else if input.Name == "env" {
+						tmplOrStaticVal = ""
+					} else {
+						errs = multierror.Append(errs, fmt.Errorf("no default value defined for input `%s`", input.Name))
 					}
+				}
 
-					if tmplOrStaticVal == nil {
-						// No default value given
-						runTaskErr := errors.Wrapf(err, "unable to run task `%s`", inTaskName)
-						errs = multierror.Append(errs, runTaskErr)
-						errs.ErrorFormat = func(es []error) string {
-							points := make([]string, len(es))
-							for i, err := range es {
-								points[i] = fmt.Sprintf("%d. %s", i+1, err)
-							}
-							return fmt.Sprintf("all the input sources failed (details follow)\n%s", strings.Join(points, "\n"))
+				if tmplOrStaticVal == nil {
+					// No default value given
+					runTaskErr := errors.Wrapf(err, "unable to run task `%s`", inTaskName)
+					errs = multierror.Append(errs, runTaskErr)
+					errs.ErrorFormat = func(es []error) string {
+						points := make([]string, len(es))
+						for i, err := range es {
+							points[i] = fmt.Sprintf("%d. %s", i+1, err)
 						}
-						return nil, errors.WithStack(errs)
+						return fmt.Sprintf("all the input sources failed (details follow)\n%s", strings.Join(points, "\n"))
 					}
-				} else {
-					maputil.SetValueAtPath(p.CachedTaskOutputs, pathComponents, tmplOrStaticVal)
+					return errors.WithStack(errs)
 				}
 			}
 		}
@@ -715,13 +855,13 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 				p.Log.Debugf("rendering %s", expr)
 				r, err := taskTemplate.Render(expr, input.Name)
 				if err != nil {
-					return nil, errors.Wrap(err, "failed to render task template")
+					return errors.Wrap(err, "failed to render task template")
 				}
 				renderedValue = r
 				p.Log.Debugf("converting type of %v(%T) to %s", renderedValue, renderedValue, input.TypeName())
 				tmplOrStaticVal, err = p.parseSupportedValueFromString(renderedValue, input.TypeName())
 				if err != nil {
-					return nil, err
+					return err
 				}
 				p.Log.Debugf("value after type conversion=%v(%T)", tmplOrStaticVal, tmplOrStaticVal)
 			}
@@ -729,7 +869,19 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 			// the dependent task succeeded with no output
 		}
 
+		mutex.Lock()
 		maputil.SetValueAtPath(values, pathComponents, tmplOrStaticVal)
+		mutex.Unlock()
+
+		return nil
+	}
+
+	// Independent producer tasks are run concurrently, whereas inputs are resolved after all the inputs they depend on
+	err := walkInputs(len(currentTask.ResolvedInputs), currentTask.InputDependencies, parallelism, func(i int) error {
+		return resolve(currentTask.ResolvedInputs[i])
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	ctx.WithField("values", values).Debugf("app finished collecting inputs")
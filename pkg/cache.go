@@ -0,0 +1,237 @@
+package variant
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mumoshu/variant/pkg/get"
+	"github.com/mumoshu/variant/pkg/util/maputil"
+	"github.com/pkg/errors"
+)
+
+// CacheConfig controls whether outputs of the task are reused when run again with the same inputs
+type CacheConfig struct {
+	// Enabled is nil when unspecified, in which case only the task run for satisfying inputs of other tasks is cached
+	Enabled *bool
+	// Persistent makes the outputs stored on disk, so that they are reused across invocations
+	Persistent bool
+	// TTL is how long outputs stored on disk are reused. Zero means forever
+	TTL time.Duration
+	// Key is a template whose rendered value is added to the key of outputs stored on disk
+	Key string
+}
+
+func NewCacheConfig(raw interface{}) (*CacheConfig, error) {
+	switch v := raw.(type) {
+	case bool:
+		return &CacheConfig{Enabled: &v}, nil
+	case map[interface{}]interface{}:
+		m, err := maputil.CastKeysToStrings(v)
+		if err != nil {
+			return nil, err
+		}
+
+		enabled := true
+		config := &CacheConfig{Enabled: &enabled, Persistent: true}
+
+		ttl, err := parseTimeout(m["ttl"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "field \"cache.ttl\" must be a duration")
+		}
+		config.TTL = ttl
+
+		switch k := m["key"].(type) {
+		case string:
+			config.Key = k
+		case nil:
+		default:
+			return nil, fmt.Errorf("field \"cache.key\" must be a string but it wasn't: %v", k)
+		}
+
+		return config, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("field \"cache\" must be either a boolean or a map like {ttl: 10m, key: \"{{ .env }}\"} but it wasn't: %v", v)
+	}
+}
+
+func (c *CacheConfig) enabled(asInput bool) bool {
+	if c == nil || c.Enabled == nil {
+		return asInput
+	}
+	return *c.Enabled
+}
+
+func (c *CacheConfig) persistent() bool {
+	return c != nil && c.Persistent
+}
+
+// taskMemo memoizes outputs of tasks, keyed by the task name and the hash of its resolved inputs.
+// Concurrent runs for the same key wait for the first one to finish and share its result
+type taskMemo struct {
+	mutex   sync.Mutex
+	entries map[string]*taskMemoEntry
+}
+
+type taskMemoEntry struct {
+	done   chan struct{}
+	output string
+	err    error
+}
+
+func newTaskMemo() *taskMemo {
+	return &taskMemo{
+		entries: map[string]*taskMemoEntry{},
+	}
+}
+
+// do returns the memoized output for the key if any, or calls f otherwise. Failures are not memoized.
+// Waiting for the run in progress for the same key stops when the ctx is done
+func (m *taskMemo) do(ctx context.Context, key string, f func() (string, error)) (string, bool, error) {
+	m.mutex.Lock()
+	if e, ok := m.entries[key]; ok {
+		m.mutex.Unlock()
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return "", false, errors.Wrapf(ctx.Err(), "cancelled while waiting for the output of the same task")
+		}
+		if e.err == nil {
+			return e.output, true, nil
+		}
+		// The first run failed. Let the caller retry on its own
+		return m.do(ctx, key, f)
+	}
+	e := &taskMemoEntry{done: make(chan struct{})}
+	m.entries[key] = e
+	m.mutex.Unlock()
+
+	e.output, e.err = f()
+
+	if e.err != nil {
+		m.mutex.Lock()
+		delete(m.entries, key)
+		m.mutex.Unlock()
+	}
+	close(e.done)
+
+	return e.output, false, e.err
+}
+
+// taskMemoKey returns the key identifying the run of the task with the variables
+func taskMemoKey(taskName TaskName, vars map[string]interface{}) (string, error) {
+	hash, err := hashOf(vars)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s@%s", taskName.ShortString(), hash), nil
+}
+
+// hashOf returns the hash of the canonical representation of the value
+func hashOf(v interface{}) (string, error) {
+	canonical, err := maputil.RecursivelyStringifyKeysOfAny(v)
+	if err != nil {
+		return "", err
+	}
+
+	// Keys of maps are sorted on marshaling, so that the same variables result in the same hash
+	bs, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(bs)), nil
+}
+
+// CacheDir is where outputs of tasks are stored across invocations
+var CacheDir = filepath.Join(get.CacheBaseDir, "cache")
+
+// ClearCache removes all the task outputs stored on disk
+func ClearCache() error {
+	return os.RemoveAll(CacheDir)
+}
+
+// taskOutputCache stores outputs of tasks on disk
+type taskOutputCache struct {
+	dir string
+}
+
+type taskOutputCacheEntry struct {
+	Output    string    `json:"output"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// path returns the path to the file storing the output of the task run with the variables, in the environment.
+// key is the rendered `cache.key` of the task
+func (c taskOutputCache) path(taskName TaskName, vars map[string]interface{}, env string, key string) (string, error) {
+	hash, err := hashOf(map[string]interface{}{
+		"inputs": vars,
+		"env":    env,
+		"key":    key,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(c.dir, strings.Join(taskName.Components, "_"), hash+".json"), nil
+}
+
+// get returns the stored output unless it is older than the ttl
+func (c taskOutputCache) get(path string, ttl time.Duration) (string, bool, error) {
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	var entry taskOutputCacheEntry
+	if err := json.Unmarshal(bs, &entry); err != nil {
+		return "", false, errors.Wrapf(err, "failed parsing %s", path)
+	}
+
+	if ttl > 0 && time.Since(entry.CreatedAt) > ttl {
+		return "", false, nil
+	}
+
+	return entry.Output, true, nil
+}
+
+func (c taskOutputCache) put(path string, output string) error {
+	bs, err := json.Marshal(taskOutputCacheEntry{Output: output, CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that concurrent invocations never read a partially written file
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
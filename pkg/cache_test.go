@@ -0,0 +1,155 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskMemo(t *testing.T) {
+	memo := newTaskMemo()
+
+	var mutex sync.Mutex
+	calls := 0
+	run := func() (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		return fmt.Sprintf("out%d", calls), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, _, err := memo.do(context.Background(), "k", run)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if out != "out1" {
+				t.Errorf("unexpected output: expected out1, got %s", out)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("unexpected number of calls: expected 1, got %d", calls)
+	}
+
+	if _, _, err := memo.do(context.Background(), "failing", func() (string, error) { return "", fmt.Errorf("simulated error") }); err == nil {
+		t.Fatalf("expected error, but succeeded")
+	}
+
+	out, hit, err := memo.do(context.Background(), "failing", func() (string, error) { return "recovered", nil })
+	if err != nil || hit || out != "recovered" {
+		t.Errorf("failures must not be memoized: out=%s, hit=%v, err=%v", out, hit, err)
+	}
+
+	// A waiter for the run in progress is unblocked by cancellation, as the run may never finish
+	started, release := make(chan struct{}), make(chan struct{})
+	go memo.do(context.Background(), "stuck", func() (string, error) {
+		close(started)
+		<-release
+		return "", nil
+	})
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() {
+		_, _, err := memo.do(ctx, "stuck", run)
+		waited <- err
+	}()
+	cancel()
+
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Errorf("expected error on cancellation, but succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the waiter wasn't unblocked by cancellation")
+	}
+}
+
+func TestTaskMemoKey(t *testing.T) {
+	name := TaskName{Components: []string{"app", "lookup"}}
+
+	k1, err := taskMemoKey(name, map[string]interface{}{"a": 1, "b": map[interface{}]interface{}{"c": "d"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k2, err := taskMemoKey(name, map[string]interface{}{"b": map[string]interface{}{"c": "d"}, "a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k3, err := taskMemoKey(name, map[string]interface{}{"a": 2, "b": map[string]interface{}{"c": "d"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if k1 != k2 {
+		t.Errorf("expected the same key for the same inputs: %s != %s", k1, k2)
+	}
+	if k1 == k3 {
+		t.Errorf("expected different keys for different inputs: %s", k1)
+	}
+}
+
+func TestTaskOutputCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-cache")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := taskOutputCache{dir: dir}
+	name := TaskName{Components: []string{"app", "ami"}}
+
+	path, err := cache.path(name, map[string]interface{}{"region": "us-east-1"}, "dev", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, other := range []struct {
+		vars map[string]interface{}
+		env  string
+		key  string
+	}{
+		{vars: map[string]interface{}{"region": "us-west-2"}, env: "dev"},
+		{vars: map[string]interface{}{"region": "us-east-1"}, env: "prod"},
+		{vars: map[string]interface{}{"region": "us-east-1"}, env: "dev", key: "k"},
+	} {
+		p, err := cache.path(name, other.vars, other.env, other.key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p == path {
+			t.Errorf("expected a different path for %+v: %s", other, p)
+		}
+	}
+
+	if _, hit, err := cache.get(path, 0); err != nil || hit {
+		t.Fatalf("unexpected hit before put: hit=%v, err=%v", hit, err)
+	}
+
+	if err := cache.put(path, "ami-123"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, hit, err := cache.get(path, time.Hour)
+	if err != nil || !hit || out != "ami-123" {
+		t.Errorf("unexpected result: out=%s, hit=%v, err=%v", out, hit, err)
+	}
+
+	if _, hit, err := cache.get(path, time.Nanosecond); err != nil || hit {
+		t.Errorf("expected expired entry to miss: hit=%v, err=%v", hit, err)
+	}
+}
@@ -43,6 +43,14 @@ type CommandError struct {
 	error
 	TaskName TaskName
 	Cause    string
+	// ExitStatus is the exit status of the failed script, or zero when the failure wasn't caused by a script
+	ExitStatus int
+}
+
+// TimeoutError returns the timeout that made the command fail, if any
+func (e CommandError) TimeoutError() (TimeoutError, bool) {
+	timeoutErr, ok := rootCause(e.error).(TimeoutError)
+	return timeoutErr, ok
 }
 
 func (p *CobraAdapter) GenerateCommand(task *Task, rootCommand *cobra.Command) (*cobra.Command, error) {
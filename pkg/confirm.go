@@ -0,0 +1,83 @@
+package variant
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// DefaultConfirmAnswer is the answer that confirms a prompt by default
+const DefaultConfirmAnswer = "y"
+
+// stdinIsTerminal returns true when the user is able to answer prompts interactively
+var stdinIsTerminal = func() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// confirmMutex prevents prompts from concurrently running tasks and steps from interleaving, and guards stdinReader
+var confirmMutex sync.Mutex
+
+// stdinReader is shared by every prompt, so that input buffered while reading an answer isn't lost for the next prompt
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// confirm asks the user for the expected answer to the prompt.
+// It fails closed when the stdin isn't a terminal so that non-interactive runs don't hang, unless `--yes` is given
+func (p *Application) confirm(prompt, expected, def string) (bool, error) {
+	if p.Yes {
+		p.Log.Debugf("assumed %q for %q due to --yes", expected, prompt)
+		return true, nil
+	}
+
+	if !stdinIsTerminal() {
+		return false, fmt.Errorf("confirmation required for %q but stdin is not a terminal. Pass --yes to proceed non-interactively", prompt)
+	}
+
+	confirmMutex.Lock()
+	defer confirmMutex.Unlock()
+
+	return askConfirmation(stdinReader, os.Stderr, prompt, expected, def)
+}
+
+func askConfirmation(in *bufio.Reader, out io.Writer, prompt, expected, def string) (bool, error) {
+	if expected == "" {
+		expected = DefaultConfirmAnswer
+	}
+
+	var hint string
+	switch {
+	case strings.EqualFold(expected, DefaultConfirmAnswer) && strings.EqualFold(def, expected):
+		hint = "[Y/n]"
+	case strings.EqualFold(expected, DefaultConfirmAnswer):
+		hint = "[y/N]"
+	case def != "":
+		hint = fmt.Sprintf("(type %q to confirm, defaults to %q)", expected, def)
+	default:
+		hint = fmt.Sprintf("(type %q to confirm)", expected)
+	}
+
+	if _, err := fmt.Fprintf(out, "%s %s: ", strings.TrimSpace(prompt), hint); err != nil {
+		return false, err
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, errors.Wrapf(err, "failed reading answer")
+	}
+
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		answer = def
+	}
+
+	if strings.EqualFold(expected, DefaultConfirmAnswer) && strings.EqualFold(answer, "yes") {
+		return true, nil
+	}
+
+	return strings.EqualFold(answer, expected), nil
+}
@@ -0,0 +1,73 @@
+package variant
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAskConfirmation(t *testing.T) {
+	testcases := []struct {
+		answer         string
+		expected       string
+		def            string
+		confirmed      bool
+		expectedPrompt string
+	}{
+		{answer: "y\n", confirmed: true, expectedPrompt: "ok? [y/N]: "},
+		{answer: "YES\n", confirmed: true, expectedPrompt: "ok? [y/N]: "},
+		{answer: "\n", confirmed: false, expectedPrompt: "ok? [y/N]: "},
+		{answer: "", def: "y", confirmed: true, expectedPrompt: "ok? [Y/n]: "},
+		{answer: "n\n", def: "y", confirmed: false, expectedPrompt: "ok? [Y/n]: "},
+		{answer: "prd\n", expected: "prd", confirmed: true, expectedPrompt: `ok? (type "prd" to confirm): `},
+		{answer: "y\n", expected: "prd", confirmed: false, expectedPrompt: `ok? (type "prd" to confirm): `},
+	}
+
+	for i, tc := range testcases {
+		var out bytes.Buffer
+		confirmed, err := askConfirmation(bufio.NewReader(strings.NewReader(tc.answer)), &out, "ok?", tc.expected, tc.def)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if confirmed != tc.confirmed {
+			t.Errorf("%d: unexpected result: expected %v, got %v", i, tc.confirmed, confirmed)
+		}
+		if out.String() != tc.expectedPrompt {
+			t.Errorf("%d: unexpected prompt: expected %q, got %q", i, tc.expectedPrompt, out.String())
+		}
+	}
+}
+
+func TestAskConfirmationSharesReader(t *testing.T) {
+	// Answers typed ahead are buffered by the first prompt, and must still be read by the next one
+	in := bufio.NewReader(strings.NewReader("y\nprd\n"))
+
+	for i, expected := range []string{"", "prd"} {
+		var out bytes.Buffer
+		confirmed, err := askConfirmation(in, &out, "ok?", expected, "")
+		if err != nil || !confirmed {
+			t.Errorf("%d: expected confirmation, got %v, %v", i, confirmed, err)
+		}
+	}
+}
+
+func TestConfirmFailsClosedWithoutTerminal(t *testing.T) {
+	prev := stdinIsTerminal
+	stdinIsTerminal = func() bool { return false }
+	defer func() { stdinIsTerminal = prev }()
+
+	app := &Application{Log: logrus.StandardLogger()}
+	if _, err := app.confirm("ok?", "", ""); err == nil {
+		t.Errorf("expected error without a terminal, but succeeded")
+	}
+
+	app.Yes = true
+	confirmed, err := app.confirm("ok?", "", "")
+	if err != nil || !confirmed {
+		t.Errorf("expected confirmation with --yes, got %v, %v", confirmed, err)
+	}
+}
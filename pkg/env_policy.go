@@ -0,0 +1,118 @@
+package variant
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mumoshu/variant/pkg/util/stringutil"
+)
+
+// EnvPolicy restricts the environment variables passed to scripts, so that tasks behave the same regardless of who runs them
+type EnvPolicy struct {
+	// Inherit passes every environment variable of variant to scripts when true, which is the default
+	Inherit *bool `yaml:"inherit,omitempty"`
+	// Allow is the list of names, or glob patterns like `AWS_*`, of the environment variables passed to scripts
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+func (p *EnvPolicy) inherits() bool {
+	return p == nil || p.Inherit == nil || *p.Inherit
+}
+
+func (p *EnvPolicy) allows(name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, pattern := range p.Allow {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hostEnv returns the environment variables of variant that are passed to scripts under the policy
+func (p *EnvPolicy) hostEnv() map[string]string {
+	env := map[string]string{}
+	for _, pair := range os.Environ() {
+		splits := strings.SplitN(pair, "=", 2)
+		if len(splits) != 2 {
+			continue
+		}
+		if p.inherits() || p.allows(splits[0]) {
+			env[splits[0]] = splits[1]
+		}
+	}
+	return env
+}
+
+func (p *EnvPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range p.Allow {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q in \"allow\": %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// envPolicy returns the policy of the innermost task defining one, up to the app
+func (c ExecutionContext) envPolicy() *EnvPolicy {
+	if c.taskRunner.Task == nil {
+		return nil
+	}
+
+	if c.taskRunner.EnvPolicy != nil {
+		return c.taskRunner.EnvPolicy
+	}
+
+	if c.app.TaskRegistry == nil {
+		return nil
+	}
+
+	name, err := c.taskRunner.Name.Parent()
+	for err == nil {
+		if t := c.app.TaskRegistry.FindTask(name); t != nil && t.EnvPolicy != nil {
+			return t.EnvPolicy
+		}
+		name, err = name.Parent()
+	}
+
+	return nil
+}
+
+// inputsEnv returns the environment variables named after the inputs declared by the task, like autoenv does
+func (c ExecutionContext) inputsEnv() (map[string]string, error) {
+	if c.taskRunner.Task == nil {
+		return map[string]string{}, nil
+	}
+
+	declared := map[string]interface{}{}
+	for _, input := range c.taskRunner.Inputs {
+		if v, ok := c.taskRunner.Values[input.Name]; ok {
+			declared[input.Name] = v
+		}
+	}
+
+	return c.taskRunner.GenerateAutoenvRecursively("", declared, stringutil.ToEnvironmentName)
+}
+
+// printEnv shows the environment variables a script receives, when `--print-env` is given
+func (c ExecutionContext) printEnv(what string, env map[string]string) {
+	if !c.app.PrintEnv {
+		return
+	}
+
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+
+	c.taskLogger().Infof("%s receives %d environment variables:\n%s", what, len(pairs), strings.Join(pairs, "\n"))
+}
@@ -0,0 +1,59 @@
+package variant
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadEnvPolicy(t *testing.T) {
+	def, err := ReadTaskDefFromString(`
+envPolicy:
+  inherit: false
+  allow: [PATH, AWS_*]
+env:
+  STAGE: prd
+  PORT: 8080
+  inherit: "kept as a variable"
+script: echo
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(map[string]string{"STAGE": "prd", "PORT": "8080", "inherit": "kept as a variable"}, def.Env); diff != "" {
+		t.Errorf("unexpected env (-want +got):\n%s", diff)
+	}
+	policy := def.EnvPolicy
+	if policy == nil || policy.inherits() {
+		t.Fatalf("expected a policy not inheriting env, got %+v", policy)
+	}
+	for name, expected := range map[string]bool{"PATH": true, "AWS_PROFILE": true, "HOME": false, "MY_AWS_KEY": false} {
+		if actual := policy.allows(name); actual != expected {
+			t.Errorf("unexpected result for %s: expected %v, got %v", name, expected, actual)
+		}
+	}
+
+	if _, err := ReadTaskDefFromString("envPolicy:\n  allow: [\"[\"]\nscript: echo\n"); err == nil {
+		t.Errorf("expected error for the invalid pattern, but succeeded")
+	}
+}
+
+func TestEnvPolicyHostEnv(t *testing.T) {
+	os.Setenv("VARIANT_TEST_ALLOWED", "1")
+	os.Setenv("VARIANT_TEST_DENIED", "1")
+	defer os.Unsetenv("VARIANT_TEST_ALLOWED")
+	defer os.Unsetenv("VARIANT_TEST_DENIED")
+
+	inherit := false
+	env := (&EnvPolicy{Inherit: &inherit, Allow: []string{"VARIANT_TEST_A*"}}).hostEnv()
+	if diff := cmp.Diff(map[string]string{"VARIANT_TEST_ALLOWED": "1"}, env); diff != "" {
+		t.Errorf("unexpected env (-want +got):\n%s", diff)
+	}
+
+	var nilPolicy *EnvPolicy
+	if env := nilPolicy.hostEnv(); env["VARIANT_TEST_DENIED"] != "1" {
+		t.Errorf("expected every env var to be inherited without a policy")
+	}
+}
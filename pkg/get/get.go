@@ -44,18 +44,34 @@ func Unmarshal(src string, dst interface{}) error {
 	return nil
 }
 
+// CacheBaseDir is where variant caches files.
+// This should be shared across variant commands, so that they can share cache for the shared imports
+const CacheBaseDir = ".variant"
+
 func GetFileBytes(goGetterSrc string) ([]byte, error) {
-	// This should be shared across variant commands, so that they can share cache for the shared imports
-	cacheBaseDir := ".variant"
+	path, err := GetFile(goGetterSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %v", err)
+	}
+
+	return bytes, nil
+}
 
+// GetFile downloads the file if necessary, and returns the path to the local copy of it
+func GetFile(goGetterSrc string) (string, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	getterSrcParts := strings.Split(goGetterSrc, "//")
 	if len(getterSrcParts) != 2 {
-		return ioutil.ReadFile(goGetterSrc)
+		return goGetterSrc, nil
 	}
 
 	lastIndex := len(getterSrcParts) - 1
@@ -81,6 +97,7 @@ func GetFileBytes(goGetterSrc string) ([]byte, error) {
 	query := strings.Join([]string{fileQuery, dirQuery}, "&")
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	var cacheKey string
 	replacer := strings.NewReplacer("/", "_", ".", "_")
@@ -94,14 +111,14 @@ func GetFileBytes(goGetterSrc string) ([]byte, error) {
 
 	cached := false
 
-	dst := filepath.Join(cacheBaseDir, cacheKey)
+	dst := filepath.Join(CacheBaseDir, cacheKey)
 	{
 		stat, err := os.Stat(dst)
 		if err != nil && !os.IsNotExist(err) {
-			return nil, fmt.Errorf("stat: %v", err)
+			return "", fmt.Errorf("stat: %v", err)
 		} else if err == nil {
 			if !stat.IsDir() {
-				return nil, fmt.Errorf("%s is not directory. please remove it so that variant could use it for dependency caching", dst)
+				return "", fmt.Errorf("%s is not directory. please remove it so that variant could use it for dependency caching", dst)
 			}
 
 			cached = true
@@ -131,16 +148,9 @@ func GetFileBytes(goGetterSrc string) ([]byte, error) {
 		logrus.Tracef("client: %+v", *get)
 
 		if err := get.Get(); err != nil {
-			return nil, fmt.Errorf("get: %v", err)
+			return "", fmt.Errorf("get: %v", err)
 		}
-
-		cancel()
 	}
 
-	bytes, err := ioutil.ReadFile(filepath.Join(dst, file))
-	if err != nil {
-		return nil, fmt.Errorf("read file: %v", err)
-	}
-
-	return bytes, nil
+	return filepath.Join(dst, file), nil
 }
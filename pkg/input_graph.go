@@ -0,0 +1,80 @@
+package variant
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// walkInputs calls f for every input after f succeeded for all the inputs it depends on.
+// deps[i] lists the indices of the inputs the i-th input depends on.
+// At most parallelism calls are in flight at a time. Ready inputs are visited in the order of their indices,
+// so that inputs are resolved in the declared order when parallelism is 1.
+// No more calls are started once any call failed.
+func walkInputs(n int, deps [][]int, parallelism int, f func(i int) error) error {
+	if parallelism <= 0 {
+		parallelism = n
+	}
+
+	remaining := make([]int, n)
+	dependents := make([][]int, n)
+	for i := 0; i < n; i++ {
+		for _, d := range deps[i] {
+			remaining[i]++
+			dependents[d] = append(dependents[d], i)
+		}
+	}
+
+	type result struct {
+		i   int
+		err error
+	}
+
+	results := make(chan result)
+	started := make([]bool, n)
+	running, finished := 0, 0
+
+	var errs []error
+
+	for {
+		for i := 0; i < n && running < parallelism && len(errs) == 0; i++ {
+			if started[i] || remaining[i] > 0 {
+				continue
+			}
+			started[i] = true
+			running++
+			go func(i int) {
+				results <- result{i: i, err: f(i)}
+			}(i)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		finished++
+
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+
+		for _, d := range dependents[r.i] {
+			remaining[d]--
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		if finished < n {
+			return fmt.Errorf("unable to resolve %d inputs due to cyclic dependencies", n-finished)
+		}
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return multierror.Append(nil, errs...)
+	}
+}
@@ -0,0 +1,53 @@
+package variant
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWalkInputs(t *testing.T) {
+	testcases := []struct {
+		deps          [][]int
+		parallelism   int
+		failAt        int
+		expectedOrder []int
+		expectedMax   int
+		expectErr     bool
+	}{
+		// inputs are visited in the declared order when run sequentially
+		{deps: [][]int{nil, nil, {0, 1}}, parallelism: 1, failAt: -1, expectedOrder: []int{0, 1, 2}, expectedMax: 1},
+		// dependencies are visited first
+		{deps: [][]int{{2}, nil, nil}, parallelism: 1, failAt: -1, expectedOrder: []int{1, 2, 0}, expectedMax: 1},
+		// independent inputs are visited concurrently
+		{deps: [][]int{nil, nil, nil, {0, 1, 2}}, parallelism: 0, failAt: -1, expectedMax: 3},
+		{deps: [][]int{nil, nil, nil, {0, 1, 2}}, parallelism: 2, failAt: -1, expectedMax: 2},
+		// dependents of the failed input are never visited
+		{deps: [][]int{nil, {0}, {1}}, parallelism: 1, failAt: 0, expectedOrder: []int{0}, expectedMax: 1, expectErr: true},
+		{deps: [][]int{{1}, {0}}, parallelism: 1, failAt: -1, expectedOrder: nil, expectedMax: 0, expectErr: true},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			r := &concurrencyRecorder{}
+
+			err := walkInputs(len(tc.deps), tc.deps, tc.parallelism, func(i int) error {
+				return r.run(i, tc.failAt)
+			})
+
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, but succeeded")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.max != tc.expectedMax {
+				t.Errorf("unexpected max concurrency: expected %d, got %d", tc.expectedMax, r.max)
+			}
+			if tc.parallelism == 1 && !reflect.DeepEqual(r.order, tc.expectedOrder) {
+				t.Errorf("unexpected order: expected %v, got %v", tc.expectedOrder, r.order)
+			}
+		})
+	}
+}
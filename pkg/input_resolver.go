@@ -2,13 +2,17 @@ package variant
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 type InputResolver interface {
-	ResolveInputs()
-	ResolveInputsForTask(flowDef *Task) []*Input
-	ResolveInputsForTaskKey(currentTaskKey TaskName, path string) []*Input
+	ResolveInputs() error
+	ResolveInputsForTask(flowDef *Task) ([]*Input, error)
+	ResolveInputsForTaskKey(currentTaskKey TaskName) ([]*Input, error)
 }
 
 type RegistryBasedInputResolver struct {
@@ -24,17 +28,64 @@ func NewRegistryBasedInputResolver(registry *TaskRegistry, flowKeyCreator *TaskN
 	}
 }
 
-func (r *RegistryBasedInputResolver) ResolveInputs() {
-	for _, flow := range r.registry.Tasks() {
-		flow.ResolvedInputs = r.ResolveInputsForTask(flow)
+func (r *RegistryBasedInputResolver) ResolveInputs() error {
+	tasks := r.registry.Tasks()
+
+	// Resolve in the order of names so that a cyclic dependency is always reported from the same task
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		flow := tasks[name]
+		inputs, err := r.ResolveInputsForTask(flow)
+		if err != nil {
+			return err
+		}
+		flow.ResolvedInputs = inputs
+		flow.InputDependencies = r.resolveInputDependencies(flow.ResolvedInputs)
+	}
+	return nil
+}
+
+// resolveInputDependencies builds the dependency graph among the inputs.
+// An input depends on the inputs of the task that may produce its value, as running the task requires them.
+// An input also depends on the preceding inputs produced by the same task, so that the task runs only once and its output is reused
+func (r *RegistryBasedInputResolver) resolveInputDependencies(inputs []*Input) [][]int {
+	deps := make([][]int, len(inputs))
+
+	producers := make([]string, len(inputs))
+	for i, input := range inputs {
+		producers[i] = r.flowKeyCreator.FromResolvedInput(input).String()
 	}
+
+	for i := range inputs {
+		for j, other := range inputs {
+			if j == i {
+				continue
+			}
+			if other.TaskKey.String() == producers[i] || (j < i && producers[j] == producers[i]) {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	return deps
 }
 
-func (r *RegistryBasedInputResolver) ResolveInputsForTask(flowDef *Task) []*Input {
-	return r.ResolveInputsForTaskKey(flowDef.Name, "")
+func (r *RegistryBasedInputResolver) ResolveInputsForTask(flowDef *Task) ([]*Input, error) {
+	return r.ResolveInputsForTaskKey(flowDef.Name)
 }
 
-func (r *RegistryBasedInputResolver) ResolveInputsForTaskKey(currentTaskKey TaskName, path string) []*Input {
+func (r *RegistryBasedInputResolver) ResolveInputsForTaskKey(currentTaskKey TaskName) ([]*Input, error) {
+	return r.resolveInputsForTaskKey(currentTaskKey, []TaskName{})
+}
+
+// resolveInputsForTaskKey resolves inputs of the task and the tasks producing them recursively.
+// chain holds the tasks depending on the current task, so that cyclic dependencies can be detected
+func (r *RegistryBasedInputResolver) resolveInputsForTaskKey(currentTaskKey TaskName, chain []TaskName) ([]*Input, error) {
 	inputs := []*Input{}
 
 	ctx := log.WithFields(log.Fields{"prefix": fmt.Sprintf("%s", currentTaskKey.String())})
@@ -44,15 +95,24 @@ func (r *RegistryBasedInputResolver) ResolveInputsForTaskKey(currentTaskKey Task
 	if currentTask == nil {
 		allTasks := r.registry.AllTaskKeys()
 		ctx.Debugf("is not a Task in: %v", allTasks)
-		return []*Input{}
+		return []*Input{}, nil
+	}
+
+	if err := checkCyclicDependency(chain, currentTaskKey); err != nil {
+		return nil, errors.Wrapf(err, "failed resolving inputs of task `%s`", chain[0].ShortString())
 	}
 
+	chain = append(append([]TaskName{}, chain...), currentTaskKey)
+
 	for _, input := range currentTask.Inputs {
 		childKey := r.flowKeyCreator.FromInput(input)
 
 		ctx.Debugf("depends on %s", childKey.String())
 
-		vars := r.ResolveInputsForTaskKey(childKey, fmt.Sprintf("%s.", currentTaskKey.String()))
+		vars, err := r.resolveInputsForTaskKey(childKey, chain)
+		if err != nil {
+			return nil, err
+		}
 
 		for _, v := range vars {
 			inputs = append(inputs, v)
@@ -69,5 +129,24 @@ func (r *RegistryBasedInputResolver) ResolveInputsForTaskKey(currentTaskKey Task
 		inputs = append(inputs, input)
 	}
 
-	return inputs
+	return inputs, nil
+}
+
+// checkCyclicDependency returns an error describing the cycle like `a -> b.x -> a` when the task is already in the chain of dependent tasks
+func checkCyclicDependency(chain []TaskName, next TaskName) error {
+	for i, t := range chain {
+		if t.String() != next.String() {
+			continue
+		}
+
+		path := []string{}
+		for _, c := range chain[i:] {
+			path = append(path, c.ShortString())
+		}
+		path = append(path, next.ShortString())
+
+		return errors.Errorf("cyclic dependency detected: %s", strings.Join(path, " -> "))
+	}
+
+	return nil
 }
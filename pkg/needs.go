@@ -0,0 +1,103 @@
+package variant
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mumoshu/variant/pkg/api/task"
+	"github.com/pkg/errors"
+)
+
+// resolveNeeds resolves names of the tasks needed by each task, and detects cyclic dependencies among them.
+// A needed task is looked up from the scope of the needing task towards the root, the innermost first
+func resolveNeeds(registry *TaskRegistry, namer *TaskNamer) error {
+	keys := []string{}
+	for k := range registry.Tasks() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		t := registry.Tasks()[k]
+		t.ResolvedNeeds = nil
+		for _, need := range t.Needs {
+			name, ok := lookupNeededTask(registry, namer, t.Name, need)
+			if !ok {
+				return errors.Errorf("task `%s` needs task `%s`, which doesn't exist", t.Name.ShortString(), need)
+			}
+			t.ResolvedNeeds = append(t.ResolvedNeeds, name)
+		}
+	}
+
+	for _, k := range keys {
+		if err := checkCyclicNeeds(registry, registry.Tasks()[k], []TaskName{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lookupNeededTask(registry *TaskRegistry, namer *TaskNamer, taskName TaskName, need string) (TaskName, bool) {
+	for scope := taskName.Components[:len(taskName.Components)-1]; len(scope) > 1; scope = scope[:len(scope)-1] {
+		name := namer.FromString(fmt.Sprintf("%s.%s", TaskName{Components: scope}.String(), need))
+		if registry.FindTask(name) != nil {
+			return name, true
+		}
+	}
+
+	name := namer.FromInputName(need)
+
+	return name, registry.FindTask(name) != nil
+}
+
+func checkCyclicNeeds(registry *TaskRegistry, t *Task, chain []TaskName) error {
+	if err := checkCyclicDependency(chain, t.Name); err != nil {
+		return errors.Wrapf(err, "failed resolving tasks needed by `%s`", chain[0].ShortString())
+	}
+
+	chain = append(append([]TaskName{}, chain...), t.Name)
+
+	for _, need := range t.ResolvedNeeds {
+		if err := checkCyclicNeeds(registry, registry.FindTask(need), chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runNeeds runs the tasks needed by the task, each of them at most once per invocation.
+// Needed tasks are run concurrently up to the parallelism
+func (t *TaskRunner) runNeeds(context ExecutionContext, project *Application) error {
+	parallelism := project.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	return runConcurrently(len(t.ResolvedNeeds), parallelism, true, func(i int) error {
+		name := t.ResolvedNeeds[i]
+
+		// The needed task may be still running as a caller of this task, in which case waiting for it would never end
+		if err := context.checkCyclicCall(name); err != nil {
+			return errors.Wrapf(err, "failed running tasks needed by `%s`", t.Name.ShortString())
+		}
+
+		app := *project
+		if parallelism > 1 {
+			app.outputPrefix = name.ShortString()
+			if project.outputPrefix != "" {
+				app.outputPrefix = fmt.Sprintf("%s/%s", project.outputPrefix, name.ShortString())
+			}
+		}
+
+		_, hit, err := project.memo.do(context.Context(), fmt.Sprintf("needs:%s", name.String()), func() (string, error) {
+			return app.RunTask(context.Context(), name, []string{}, task.NewArguments(), map[string]interface{}{}, context.asInput, context.trace...)
+		})
+		if hit {
+			project.Log.Debugf("task %s needed by %s has already run", name.ShortString(), t.Name.ShortString())
+		}
+
+		return errors.Wrapf(err, "task %s needed by %s failed", name.ShortString(), t.Name.ShortString())
+	})
+}
@@ -0,0 +1,196 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type RetryConfig struct {
+	// Attempts is the maximum number of runs including the first one
+	Attempts int
+	// Delay is the duration to wait before the first retry
+	Delay time.Duration
+	// Backoff is the factor the delay is multiplied by after each retry
+	Backoff float64
+	// MaxDelay caps the delay grown by Backoff. Zero means no limit
+	MaxDelay time.Duration
+	RetryOn  RetryOnConfig
+}
+
+// RetryOnConfig narrows down failures to be retried. When empty, any failure is retried
+type RetryOnConfig struct {
+	ExitCodes []int
+	Stderr    *regexp.Regexp
+}
+
+func NewRetryConfig(raw map[string]interface{}) (*RetryConfig, error) {
+	config := &RetryConfig{
+		Attempts: 3,
+		Delay:    time.Second,
+		Backoff:  1,
+	}
+
+	switch v := raw["attempts"].(type) {
+	case int:
+		config.Attempts = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"attempts\" must be an integer but it wasn't: %v", v)
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"delay", &config.Delay},
+		{"maxDelay", &config.MaxDelay},
+	} {
+		switch v := raw[f.key].(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %q must be a duration", f.key)
+			}
+			*f.dst = d
+		case int:
+			*f.dst = time.Duration(v) * time.Second
+		case nil:
+		default:
+			return nil, fmt.Errorf("field %q must be a duration like \"10s\" but it wasn't: %v", f.key, v)
+		}
+	}
+
+	switch v := raw["backoff"].(type) {
+	case int:
+		config.Backoff = float64(v)
+	case float64:
+		config.Backoff = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"backoff\" must be a number but it wasn't: %v", v)
+	}
+
+	retryOn := NewStepDef(raw).GetStringMapOrEmpty("retryOn")
+
+	switch v := retryOn["exitCodes"].(type) {
+	case []interface{}:
+		for _, c := range v {
+			code, ok := c.(int)
+			if !ok {
+				return nil, fmt.Errorf("field \"retryOn.exitCodes\" must be an array of integers but it wasn't: %v", v)
+			}
+			config.RetryOn.ExitCodes = append(config.RetryOn.ExitCodes, code)
+		}
+	case int:
+		config.RetryOn.ExitCodes = []int{v}
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"retryOn.exitCodes\" must be an array of integers but it wasn't: %v", v)
+	}
+
+	switch v := retryOn["stderr"].(type) {
+	case string:
+		r, err := regexp.Compile(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field \"retryOn.stderr\" must be a regular expression")
+		}
+		config.RetryOn.Stderr = r
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"retryOn.stderr\" must be a string but it wasn't: %v", v)
+	}
+
+	if config.Attempts < 1 {
+		return nil, fmt.Errorf("field \"attempts\" must be greater than 0: %d", config.Attempts)
+	}
+
+	return config, nil
+}
+
+// Do runs f until it succeeds, the failure isn't retryable, or the attempts are exhausted
+func (c RetryConfig) Do(ctx context.Context, logger *logrus.Entry, f func() (string, error)) (string, error) {
+	delay := c.Delay
+
+	for attempt := 1; ; attempt++ {
+		output, err := f()
+		if err == nil {
+			return output, nil
+		}
+
+		if ctx.Err() != nil {
+			return output, err
+		}
+
+		if attempt >= c.Attempts {
+			if c.Attempts > 1 {
+				return output, errors.Wrapf(err, "gave up after %d attempts", attempt)
+			}
+			return output, err
+		}
+
+		if !c.RetryOn.matches(err, output) {
+			logger.Debugf("not retrying as the failure doesn't match retryOn: %v", err)
+			return output, err
+		}
+
+		logger.Warnf("attempt %d of %d failed. retrying in %s: %v", attempt, c.Attempts, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return output, err
+		}
+
+		delay = time.Duration(float64(delay) * c.Backoff)
+		if c.MaxDelay > 0 && delay > c.MaxDelay {
+			delay = c.MaxDelay
+		}
+	}
+}
+
+func (c RetryOnConfig) matches(err error, output string) bool {
+	if len(c.ExitCodes) == 0 && c.Stderr == nil {
+		return true
+	}
+
+	stderr := output
+	scriptErr, isScriptErr := errors.Cause(err).(ScriptError)
+	if isScriptErr {
+		stderr = scriptErr.Stderr
+	}
+
+	if isScriptErr {
+		for _, code := range c.ExitCodes {
+			if code == scriptErr.ExitStatus {
+				return true
+			}
+		}
+	}
+
+	return c.Stderr != nil && c.Stderr.MatchString(stderr)
+}
+
+// RetryStep re-runs the step on failure according to the retry config
+type RetryStep struct {
+	Step
+	Retry RetryConfig
+}
+
+func (s RetryStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	var out StepStringOutput
+
+	logger := context.taskLogger().WithField("step", s.GetName())
+
+	_, err := s.Retry.Do(context.Context(), logger, func() (string, error) {
+		var err error
+		out, err = s.Step.Run(context)
+		return out.String, err
+	})
+
+	return out, err
+}
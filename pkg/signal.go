@@ -0,0 +1,78 @@
+package variant
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultGracePeriod is how long running scripts are given to exit after being signaled, before they are killed
+const DefaultGracePeriod = 10 * time.Second
+
+type signalCtxKey struct{}
+
+type receivedSignal struct {
+	mutex  sync.Mutex
+	signal os.Signal
+}
+
+// WithSignals returns a context that is cancelled on SIGINT or SIGTERM.
+// The received signal is forwarded to the running scripts, which are killed after the grace period.
+// Receiving another signal while terminating makes the process exit immediately.
+// The returned function stops relaying signals.
+func WithSignals(parent context.Context, log *logrus.Logger) (context.Context, func()) {
+	received := &receivedSignal{}
+
+	ctx, cancel := context.WithCancel(context.WithValue(parent, signalCtxKey{}, received))
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	stopped := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Warnf("received %v. terminating running tasks...", sig)
+			received.mutex.Lock()
+			received.signal = sig
+			received.mutex.Unlock()
+			cancel()
+		case <-stopped:
+			return
+		}
+
+		select {
+		case sig := <-sigs:
+			log.Errorf("received %v again. exiting without waiting for tasks to terminate", sig)
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-stopped:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(stopped)
+		cancel()
+	}
+}
+
+// signalFromContext returns the signal that cancelled the context, if any
+func signalFromContext(ctx context.Context) (syscall.Signal, bool) {
+	received, ok := ctx.Value(signalCtxKey{}).(*receivedSignal)
+	if !ok {
+		return 0, false
+	}
+
+	received.mutex.Lock()
+	defer received.mutex.Unlock()
+
+	sig, ok := received.signal.(syscall.Signal)
+
+	return sig, ok
+}
@@ -0,0 +1,134 @@
+package variant
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mumoshu/variant/pkg/get"
+	"github.com/pkg/errors"
+)
+
+// ChecksumDir is where checksums of sources of tasks recorded on the last successful runs are stored
+var ChecksumDir = filepath.Join(get.CacheBaseDir, "checksums")
+
+// sourcesChecksum returns the checksum of the files matching the glob patterns, along with the script, the step definitions and the inputs of the task.
+// Directories are walked recursively
+func sourcesChecksum(sources []string, script string, stepDefs []interface{}, values map[string]interface{}) (string, error) {
+	files, err := globFiles(sources)
+	if err != nil {
+		return "", err
+	}
+
+	steps, err := hashOf(stepDefs)
+	if err != nil {
+		return "", errors.Wrap(err, "failed hashing steps")
+	}
+
+	inputs, err := hashOf(values)
+	if err != nil {
+		return "", errors.Wrap(err, "failed hashing inputs")
+	}
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "script:%s\x00steps:%s\x00inputs:%s\x00", script, steps, inputs)
+
+	for _, f := range files {
+		if err := hashFile(h, f); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(h, "file:%s\x00", path)
+
+	if _, err := io.Copy(h, f); err != nil {
+		return errors.Wrapf(err, "failed reading %s", path)
+	}
+
+	return nil
+}
+
+// globFiles returns the sorted list of files matching any of the patterns
+func globFiles(patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid glob pattern %q", pattern)
+		}
+
+		for _, m := range matches {
+			err := filepath.Walk(m, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() {
+					seen[path] = true
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	files := []string{}
+	for f := range seen {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// generatesExist returns true when every glob pattern matches at least one file
+func generatesExist(generates []string) (bool, error) {
+	for _, pattern := range generates {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid glob pattern %q", pattern)
+		}
+		if len(matches) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func checksumFile(taskName TaskName) string {
+	return filepath.Join(ChecksumDir, strings.Join(taskName.Components, "_"))
+}
+
+func readChecksum(taskName TaskName) (string, error) {
+	bs, err := ioutil.ReadFile(checksumFile(taskName))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(bs)), err
+}
+
+func writeChecksum(taskName TaskName, checksum string) error {
+	if err := os.MkdirAll(ChecksumDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(checksumFile(taskName), []byte(checksum+"\n"), 0644)
+}
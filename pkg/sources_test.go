@@ -0,0 +1,113 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourcesChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-sources")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	checksum := func(script string, values map[string]interface{}) string {
+		c, err := sourcesChecksum([]string{filepath.Join(dir, "*.txt")}, script, nil, values)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return c
+	}
+
+	write("a.txt", "a")
+
+	base := checksum("echo", map[string]interface{}{"x": 1})
+
+	if c := checksum("echo", map[string]interface{}{"x": 1}); c != base {
+		t.Errorf("expected the same checksum for the same sources: %s != %s", c, base)
+	}
+	if c := checksum("echo changed", map[string]interface{}{"x": 1}); c == base {
+		t.Errorf("expected a different checksum for a different script")
+	}
+	if c := checksum("echo", map[string]interface{}{"x": 2}); c == base {
+		t.Errorf("expected a different checksum for different inputs")
+	}
+
+	write("a.txt", "changed")
+	if c := checksum("echo", map[string]interface{}{"x": 1}); c == base {
+		t.Errorf("expected a different checksum for a changed file")
+	}
+
+	exist, err := generatesExist([]string{filepath.Join(dir, "*.out")})
+	if err != nil || exist {
+		t.Errorf("expected missing generated files: exist=%v, err=%v", exist, err)
+	}
+}
+
+func TestUpToDateDetectsChangedSteps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-sources")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	prev := ChecksumDir
+	ChecksumDir = filepath.Join(dir, "checksums")
+	defer func() { ChecksumDir = prev }()
+
+	generated := filepath.Join(dir, "out.txt")
+	if err := ioutil.WriteFile(generated, []byte("out"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runner := func(script string) *TaskRunner {
+		def, err := ReadTaskDefFromString(fmt.Sprintf(`
+generates:
+- %s
+steps:
+- script: %s
+`, generated, script))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		task := &Task{TaskDef: *def, Name: TaskName{Components: []string{"app", "build"}}}
+		return &TaskRunner{Task: task, Values: map[string]interface{}{}, Template: NewTaskTemplate(task, map[string]interface{}{})}
+	}
+
+	upToDate := func(r *TaskRunner) (string, bool) {
+		ctx := NewStepExecutionContext(context.Background(), Application{Name: "app"}, *r, r.Template, false, nil)
+		checksum, ok, err := r.upToDate(ctx, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return checksum, ok
+	}
+
+	original := runner("echo a")
+	checksum, ok := upToDate(original)
+	if ok {
+		t.Fatalf("expected the task to run for the first time")
+	}
+	if err := writeChecksum(original.Name, checksum); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := upToDate(runner("echo a")); !ok {
+		t.Errorf("expected the unchanged task to be up to date")
+	}
+
+	if _, ok := upToDate(runner("echo b")); ok {
+		t.Errorf("expected the task with the edited step to run again")
+	}
+}
@@ -11,6 +11,8 @@ type Caller interface {
 
 type LoadingContext interface {
 	LoadStep(config StepDef) (Step, error)
+	// BaseDir is the directory relative paths in the step, like `scriptFile`, are resolved against
+	BaseDir() string
 }
 
 type Step interface {
@@ -21,4 +23,6 @@ type Step interface {
 
 type StepStringOutput struct {
 	String string
+	// Values are made available to subsequent steps in addition to String, which is bound to the step's name
+	Values map[string]interface{}
 }
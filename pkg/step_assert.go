@@ -0,0 +1,141 @@
+package variant
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mumoshu/variant/pkg/util/maputil"
+	"github.com/pkg/errors"
+)
+
+type AssertStepLoader struct{}
+
+func (l AssertStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	assertData := config.Get("assert")
+	if assertData == nil {
+		return nil, fmt.Errorf("no field named assert exists, config=%v", config)
+	}
+
+	result := AssertStep{
+		Name:   config.GetName(),
+		Silent: config.Silent(),
+	}
+
+	items, ok := assertData.([]interface{})
+	if !ok {
+		items = []interface{}{assertData}
+	}
+
+	for i, item := range items {
+		switch v := item.(type) {
+		case string:
+			result.Assertions = append(result.Assertions, Assertion{Condition: v})
+		case map[interface{}]interface{}, map[string]interface{}:
+			m, err := maputil.RecursivelyStringifyKeys(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading assertion %d failed", i)
+			}
+			schema, ok := m["schema"]
+			if !ok {
+				return nil, fmt.Errorf("assertion %d must have the \"schema\" field: %v", i, v)
+			}
+			value, ok := m["value"].(string)
+			if !ok {
+				return nil, fmt.Errorf("field \"value\" of assertion %d must be a template expression: %v", i, v)
+			}
+			result.Assertions = append(result.Assertions, Assertion{Schema: schema, Value: value})
+		default:
+			return nil, fmt.Errorf("assertion %d must be either a template expression or a map containing \"schema\" and \"value\" but it wasn't: %v", i, v)
+		}
+	}
+
+	switch v := config.Get("message").(type) {
+	case string:
+		result.Message = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"message\" must be a string but it wasn't: %v", v)
+	}
+
+	return result, nil
+}
+
+func NewAssertStepLoader() AssertStepLoader {
+	return AssertStepLoader{}
+}
+
+// Assertion is either a template condition that must render to a truthy value,
+// or a template rendering a value that must conform to the JSON schema
+type Assertion struct {
+	Condition string
+	Schema    interface{}
+	Value     string
+}
+
+// AssertStep fails the task with a descriptive message when any of the assertions doesn't hold
+type AssertStep struct {
+	Name       string
+	Assertions []Assertion
+	// Message is the template rendered into the message shown on failure
+	Message string
+	Silent  bool
+}
+
+func (s AssertStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	for i, a := range s.Assertions {
+		name := fmt.Sprintf("assert[%d]", i)
+
+		var violation string
+		if a.Schema == nil {
+			rendered, err := context.Render(a.Condition, name)
+			if err != nil {
+				return StepStringOutput{String: "assert error"}, errors.Wrapf(err, "assert step failed templating")
+			}
+			if !isTruthy(rendered) {
+				violation = fmt.Sprintf("%s evaluated to %q", strings.TrimSpace(a.Condition), strings.TrimSpace(rendered))
+				refs, err := context.taskTemplate.ReferencedValues(a.Condition, name)
+				if err != nil {
+					return StepStringOutput{String: "assert error"}, errors.Wrapf(err, "assert step failed templating")
+				}
+				if len(refs) > 0 {
+					violation = fmt.Sprintf("%s where %s", violation, strings.Join(refs, ", "))
+				}
+			}
+		} else {
+			value, err := context.RenderValue(a.Value, name)
+			if err != nil {
+				return StepStringOutput{String: "assert error"}, errors.Wrapf(err, "assert step failed templating")
+			}
+			if err := validateJSONSchema(a.Schema, value); err != nil {
+				bs, _ := json.Marshal(value)
+				violation = fmt.Sprintf("%s rendered to %s which doesn't conform to the schema: %s", strings.TrimSpace(a.Value), string(bs), strings.TrimSpace(err.Error()))
+			}
+		}
+
+		if violation == "" {
+			continue
+		}
+
+		msg := violation
+		if s.Message != "" {
+			m, err := context.Render(s.Message, "assert.message")
+			if err != nil {
+				return StepStringOutput{String: "assert error"}, errors.Wrapf(err, "assert step failed templating message")
+			}
+			msg = fmt.Sprintf("%s: %s", strings.TrimSpace(m), violation)
+		}
+
+		return StepStringOutput{String: msg}, fmt.Errorf("assertion failed: %s", msg)
+	}
+
+	return StepStringOutput{}, nil
+}
+
+func (s AssertStep) GetName() string {
+	return s.Name
+}
+
+func (s AssertStep) Silenced() bool {
+	return s.Silent
+}
@@ -0,0 +1,55 @@
+package variant
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertStep(t *testing.T) {
+	ctx := newTestExecutionContext(map[string]interface{}{"env": "stg", "config": `{"replicas": 0}`})
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"replicas": map[string]interface{}{"type": "integer", "minimum": 1},
+		},
+	}
+
+	testcases := []struct {
+		step     AssertStep
+		expected string
+	}{
+		{
+			step: AssertStep{Assertions: []Assertion{{Condition: `{{ ne .env "" }}`}}},
+		},
+		{
+			step:     AssertStep{Assertions: []Assertion{{Condition: `{{ eq .env "prd" }}`}}, Message: "env is {{ .env }}"},
+			expected: `env is stg: {{ eq .env "prd" }} evaluated to "false" where .env="stg"`,
+		},
+		{
+			step:     AssertStep{Assertions: []Assertion{{Condition: `{{ or (eq .env "prd") (eq .env "dev") (hasPrefix "{" .config | not) }}`}}},
+			expected: `{{ or (eq .env "prd") (eq .env "dev") (hasPrefix "{" .config | not) }} evaluated to "false" where .env="stg", .config="{\"replicas\": 0}"`,
+		},
+		{
+			step:     AssertStep{Assertions: []Assertion{{Schema: schema, Value: `{{ .config | fromYaml }}`}}},
+			expected: `{{ .config | fromYaml }} rendered to {"replicas":0} which doesn't conform to the schema`,
+		},
+	}
+
+	for i, tc := range testcases {
+		out, err := tc.step.Run(ctx)
+		if tc.expected == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%d: expected error, but succeeded", i)
+			continue
+		}
+		if !strings.HasPrefix(out.String, tc.expected) {
+			t.Errorf("%d: unexpected output: expected it to start with %q, got %q", i, tc.expected, out.String)
+		}
+	}
+}
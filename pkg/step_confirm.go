@@ -0,0 +1,92 @@
+package variant
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+type ConfirmStepLoader struct{}
+
+func (l ConfirmStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	prompt, ok := config.Get("confirm").(string)
+	if !ok {
+		return nil, fmt.Errorf("no field named confirm exists, config=%v", config)
+	}
+
+	result := ConfirmStep{
+		Name:   config.GetName(),
+		Prompt: prompt,
+		Silent: config.Silent(),
+	}
+
+	for _, field := range []struct {
+		key string
+		dst *string
+	}{
+		{"expected", &result.Expected},
+		{"default", &result.Default},
+	} {
+		switch v := config.Get(field.key).(type) {
+		case string:
+			*field.dst = v
+		case bool:
+			// YAML reads unquoted `yes` and `no` as booleans
+			if v {
+				*field.dst = "yes"
+			} else {
+				*field.dst = "no"
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("field %q must be a string but it wasn't: %v", field.key, v)
+		}
+	}
+
+	return result, nil
+}
+
+func NewConfirmStepLoader() ConfirmStepLoader {
+	return ConfirmStepLoader{}
+}
+
+// ConfirmStep fails the task unless the user answers the prompt with the expected answer
+type ConfirmStep struct {
+	Name   string
+	Prompt string
+	// Expected is the answer that confirms the prompt. Defaults to `y`
+	Expected string
+	// Default is the answer assumed when the user answered nothing
+	Default string
+	Silent  bool
+}
+
+func (s ConfirmStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	rendered := map[string]string{}
+	for k, v := range map[string]string{"prompt": s.Prompt, "expected": s.Expected, "default": s.Default} {
+		r, err := context.Render(v, fmt.Sprintf("confirm.%s", k))
+		if err != nil {
+			return StepStringOutput{String: "confirm error"}, errors.Wrapf(err, "confirm step failed templating %s", k)
+		}
+		rendered[k] = r
+	}
+
+	confirmed, err := context.app.confirm(rendered["prompt"], rendered["expected"], rendered["default"])
+	if err != nil {
+		return StepStringOutput{String: err.Error()}, errors.Wrapf(err, "confirm step failed")
+	}
+
+	if !confirmed {
+		return StepStringOutput{String: "aborted by user"}, fmt.Errorf("confirm step failed: %q was not confirmed", rendered["prompt"])
+	}
+
+	return StepStringOutput{}, nil
+}
+
+func (s ConfirmStep) GetName() string {
+	return s.Name
+}
+
+func (s ConfirmStep) Silenced() bool {
+	return s.Silent
+}
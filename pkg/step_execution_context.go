@@ -1,10 +1,16 @@
 package variant
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/mumoshu/variant/pkg/api/task"
+	log "github.com/sirupsen/logrus"
 )
 
 type ExecutionContext struct {
+	ctx          context.Context
 	app          Application
 	taskRunner   TaskRunner
 	taskTemplate *TaskTemplate
@@ -12,8 +18,9 @@ type ExecutionContext struct {
 	asInput      bool
 }
 
-func NewStepExecutionContext(app Application, taskRunner TaskRunner, taskTemplate *TaskTemplate, asInput bool, trace []*Task) ExecutionContext {
+func NewStepExecutionContext(ctx context.Context, app Application, taskRunner TaskRunner, taskTemplate *TaskTemplate, asInput bool, trace []*Task) ExecutionContext {
 	return ExecutionContext{
+		ctx:          ctx,
 		app:          app,
 		taskRunner:   taskRunner,
 		taskTemplate: taskTemplate,
@@ -22,6 +29,25 @@ func NewStepExecutionContext(app Application, taskRunner TaskRunner, taskTemplat
 	}
 }
 
+// Context is done when the task is cancelled or timed out
+func (c ExecutionContext) Context() context.Context {
+	return c.ctx
+}
+
+func (c ExecutionContext) withTimeout(timeout time.Duration) (ExecutionContext, context.CancelFunc) {
+	ctx := c
+	var cancel context.CancelFunc
+	ctx.ctx, cancel = context.WithTimeout(c.ctx, timeout)
+	return ctx, cancel
+}
+
+// detached returns a context that isn't cancelled along with the task, so that cleanup steps can run after cancellation
+func (c ExecutionContext) detached() ExecutionContext {
+	ctx := c
+	ctx.ctx = context.Background()
+	return ctx
+}
+
 func (c ExecutionContext) Values() map[string]interface{} {
 	return c.taskTemplate.values
 }
@@ -32,10 +58,40 @@ func (c ExecutionContext) WithAdditionalValues(vs map[string]interface{}) Execut
 	return ctx
 }
 
+// withStepOutput makes the output of the step available to subsequent steps
+func (c ExecutionContext) withStepOutput(s Step, out StepStringOutput) ExecutionContext {
+	vs := map[string]interface{}{}
+	if s.GetName() != "" {
+		vs[s.GetName()] = out.String
+	}
+	for k, v := range out.Values {
+		vs[k] = v
+	}
+	if len(vs) == 0 {
+		return c
+	}
+	return c.WithAdditionalValues(vs)
+}
+
+// withOutputPrefix returns a context whose scripts and tasks prefix every line they print with the name,
+// so that outputs from concurrently running steps can be told apart
+func (c ExecutionContext) withOutputPrefix(name string) ExecutionContext {
+	ctx := c
+	if c.app.outputPrefix != "" {
+		name = fmt.Sprintf("%s/%s", c.app.outputPrefix, name)
+	}
+	ctx.app.outputPrefix = name
+	return ctx
+}
+
 func (c ExecutionContext) GenerateAutoenv() (map[string]string, error) {
 	return c.taskRunner.GenerateAutoenv()
 }
 
+func (c ExecutionContext) taskLogger() *log.Entry {
+	return log.StandardLogger().WithField("app", c.app.Name).WithField("task", c.Key().ShortString())
+}
+
 func (c ExecutionContext) Caller() []Caller {
 	return []Caller{c.taskRunner.AsStepCaller()}
 }
@@ -52,6 +108,10 @@ func (c ExecutionContext) Render(expr string, name string) (string, error) {
 	return c.taskTemplate.Render(expr, name)
 }
 
+func (c ExecutionContext) RenderValue(expr string, name string) (interface{}, error) {
+	return c.taskTemplate.RenderValue(expr, name)
+}
+
 func (c ExecutionContext) Autoenv() bool {
 	return c.taskRunner.Autoenv
 }
@@ -64,6 +124,20 @@ func (c ExecutionContext) Interactive() bool {
 	return c.taskRunner.Interactive
 }
 
+// checkCyclicCall returns an error when the task is already being run by the task or its callers,
+// as tasks calling each other via `task` steps or `needs` would recurse infinitely
+func (c ExecutionContext) checkCyclicCall(next TaskName) error {
+	chain := []TaskName{}
+	for i := len(c.trace) - 1; i >= 0; i-- {
+		chain = append(chain, c.trace[i].Name)
+	}
+	return checkCyclicDependency(chain, next)
+}
+
 func (c ExecutionContext) RunAnotherTask(key string, arguments task.Arguments, scope map[string]interface{}) (string, error) {
-	return c.app.RunTaskForKeyString(key, []string{}, arguments, scope, c.asInput, c.taskRunner.Task)
+	if err := c.checkCyclicCall(c.app.TaskNamer.FromString(fmt.Sprintf("%s.%s", c.app.Name, key))); err != nil {
+		return "", err
+	}
+
+	return c.app.RunTaskForKeyString(c.ctx, key, []string{}, arguments, scope, c.asInput, c.trace...)
 }
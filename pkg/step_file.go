@@ -0,0 +1,212 @@
+package variant
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFileMode is the permission of files written by the file step by default
+const DefaultFileMode os.FileMode = 0644
+
+type FileStepLoader struct{}
+
+func (l FileStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	if config.Get("file") == nil {
+		return nil, fmt.Errorf("no field named file exists, config=%v", config)
+	}
+
+	f := NewStepDef(config.GetStringMapOrEmpty("file"))
+
+	result := FileStep{
+		Name:   config.GetName(),
+		Mode:   DefaultFileMode,
+		Silent: config.Silent(),
+	}
+
+	for _, field := range []struct {
+		key string
+		dst *string
+	}{
+		{"dest", &result.Dest},
+		{"template", &result.Template},
+		{"templateFile", &result.TemplateFile},
+	} {
+		switch v := f.Get(field.key).(type) {
+		case string:
+			*field.dst = v
+		case nil:
+		default:
+			return nil, fmt.Errorf("field \"file.%s\" must be a string but it wasn't: %v", field.key, v)
+		}
+	}
+
+	if result.Dest == "" {
+		return nil, fmt.Errorf("field \"file.dest\" must be specified: %v", config.Get("file"))
+	}
+
+	if (result.Template == "") == (result.TemplateFile == "") {
+		return nil, fmt.Errorf("exactly one of \"file.template\" and \"file.templateFile\" must be specified: %v", config.Get("file"))
+	}
+
+	switch v := f.Get("mode").(type) {
+	case int:
+		// YAML reads `mode: 0644` as an octal number
+		result.Mode = os.FileMode(v)
+	case string:
+		m, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field \"file.mode\" must be an octal number")
+		}
+		result.Mode = os.FileMode(m)
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"file.mode\" must be an octal number but it wasn't: %v", v)
+	}
+
+	switch v := f.Get("onlyIfChanged").(type) {
+	case bool:
+		result.OnlyIfChanged = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"file.onlyIfChanged\" must be a boolean but it wasn't: %v", v)
+	}
+
+	return result, nil
+}
+
+func NewFileStepLoader() FileStepLoader {
+	return FileStepLoader{}
+}
+
+// FileStep renders the template with the task's values and writes it to the destination.
+// The output is the path to the written file
+type FileStep struct {
+	Name string
+	Dest string
+	// Template is the inline template to be rendered
+	Template string
+	// TemplateFile is the path to the template to be rendered. A relative path is relative to the Variantfile
+	TemplateFile string
+	Mode         os.FileMode
+	// OnlyIfChanged prevents the file from being rewritten when its content is unchanged
+	OnlyIfChanged bool
+	Silent        bool
+}
+
+func (s FileStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	dest, err := context.Render(s.Dest, "file.dest")
+	if err != nil {
+		return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed templating dest")
+	}
+
+	tmpl := s.Template
+	if s.TemplateFile != "" {
+		path := s.TemplateFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(context.app.CommandRelativePath), path)
+		}
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed reading template")
+		}
+		tmpl = string(bs)
+	}
+
+	content, err := context.Render(tmpl, "file.template")
+	if err != nil {
+		return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed templating")
+	}
+
+	logger := context.taskLogger().WithField("step", s.GetName())
+
+	current, err := ioutil.ReadFile(dest)
+	if err != nil && !os.IsNotExist(err) {
+		return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed reading %s", dest)
+	}
+
+	if bytes.Equal(current, []byte(content)) && err == nil {
+		if s.OnlyIfChanged {
+			logger.Debugf("%s is unchanged", dest)
+			return StepStringOutput{String: dest}, nil
+		}
+	} else {
+		logger.Debugf("writing %s:\n%s", dest, lineDiff(string(current), content))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed creating the directory for %s", dest)
+	}
+
+	if err := ioutil.WriteFile(dest, []byte(content), s.Mode); err != nil {
+		return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed writing %s", dest)
+	}
+
+	// WriteFile doesn't change the permission of an existing file
+	if err := os.Chmod(dest, s.Mode); err != nil {
+		return StepStringOutput{String: "file error"}, errors.Wrapf(err, "file step failed changing mode of %s", dest)
+	}
+
+	return StepStringOutput{String: dest}, nil
+}
+
+func (s FileStep) GetName() string {
+	return s.Name
+}
+
+func (s FileStep) Silenced() bool {
+	return s.Silent
+}
+
+// lineDiff returns the lines removed from a and added in b, prefixed with `-` and `+` respectively
+func lineDiff(a, b string) string {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			fmt.Fprintf(&buf, " %s\n", x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&buf, "-%s\n", x[i])
+			i++
+		default:
+			fmt.Fprintf(&buf, "+%s\n", y[j])
+			j++
+		}
+	}
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
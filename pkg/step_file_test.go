@@ -0,0 +1,23 @@
+package variant
+
+import (
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	testcases := []struct {
+		a, b     string
+		expected string
+	}{
+		{a: "", b: "a\n", expected: "+a\n"},
+		{a: "a\nb\n", b: "a\nb\n", expected: " a\n b\n"},
+		{a: "a\nb\nc\n", b: "a\nx\nc\n", expected: " a\n-b\n+x\n c\n"},
+		{a: "a\nb\n", b: "b\n", expected: "-a\n b\n"},
+	}
+
+	for _, tc := range testcases {
+		if actual := lineDiff(tc.a, tc.b); actual != tc.expected {
+			t.Errorf("unexpected diff between %q and %q: expected %q, got %q", tc.a, tc.b, tc.expected, actual)
+		}
+	}
+}
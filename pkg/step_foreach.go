@@ -0,0 +1,249 @@
+package variant
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mumoshu/variant/pkg/util/maputil"
+	"github.com/pkg/errors"
+)
+
+type ForeachStepLoader struct{}
+
+func (l ForeachStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	if config.Get("foreach") == nil {
+		return nil, fmt.Errorf("no field named foreach exists, config=%v", config)
+	}
+
+	foreach := config.GetStringMapOrEmpty("foreach")
+
+	result := ForeachStep{
+		Name:     config.GetName(),
+		Items:    foreach["items"],
+		As:       "item",
+		Matrix:   map[string]interface{}{},
+		FailFast: true,
+		Silent:   config.Silent(),
+	}
+
+	if as, ok := foreach["as"].(string); ok && as != "" {
+		result.As = as
+	}
+
+	if foreach["matrix"] != nil {
+		result.Matrix = NewStepDef(foreach).GetStringMapOrEmpty("matrix")
+		if len(result.Matrix) == 0 {
+			return nil, fmt.Errorf("field \"foreach.matrix\" must be a non-empty map but it wasn't: %v", foreach["matrix"])
+		}
+	}
+
+	if result.Items == nil && len(result.Matrix) == 0 {
+		return nil, fmt.Errorf("either \"foreach.items\" or \"foreach.matrix\" must be specified: %v", foreach)
+	}
+
+	if result.Items != nil && len(result.Matrix) > 0 {
+		return nil, fmt.Errorf("\"foreach.items\" and \"foreach.matrix\" can't be specified at the same time: %v", foreach)
+	}
+
+	stepsData := config.Get("steps")
+	if stepsData == nil {
+		return nil, fmt.Errorf("no field named `steps` exists, config=%v", config)
+	}
+
+	steps, err := readStepsWithDefaultName(stepsData, "foreach", context)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading `steps` failed")
+	}
+	result.Steps = steps
+
+	switch v := config.Get("parallel").(type) {
+	case bool:
+		result.Parallel = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"parallel\" must be a boolean but it wasn't: %v", v)
+	}
+
+	switch v := config.Get("maxConcurrency").(type) {
+	case int:
+		result.MaxConcurrency = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"maxConcurrency\" must be an integer but it wasn't: %v", v)
+	}
+
+	switch v := config.Get("failFast").(type) {
+	case bool:
+		result.FailFast = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"failFast\" must be a boolean but it wasn't: %v", v)
+	}
+
+	return result, nil
+}
+
+func NewForeachStepLoader() ForeachStepLoader {
+	return ForeachStepLoader{}
+}
+
+type ForeachStep struct {
+	Name string
+	// Items is either an array or a template expression that evaluates to an array
+	Items interface{}
+	// As is the name of the variable each item is bound to
+	As string
+	// Matrix maps variable names to arrays or template expressions that evaluate to arrays.
+	// Steps are run once per combination of the items
+	Matrix         map[string]interface{}
+	Steps          []Step
+	Parallel       bool
+	MaxConcurrency int
+	FailFast       bool
+	Silent         bool
+}
+
+func (s ForeachStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	iterations, err := s.iterations(context)
+	if err != nil {
+		return StepStringOutput{String: "foreach error"}, errors.Wrapf(err, "`foreach` failed evaluating items")
+	}
+
+	maxConcurrency, failFast := 1, true
+	if s.Parallel {
+		maxConcurrency, failFast = s.MaxConcurrency, s.FailFast
+	}
+
+	outputs := make([]StepStringOutput, len(iterations))
+
+	err = runConcurrently(len(iterations), maxConcurrency, failFast, func(i int) error {
+		ctx := context.WithAdditionalValues(iterations[i])
+		if s.Parallel {
+			ctx = ctx.withOutputPrefix(fmt.Sprintf("%s[%d]", s.Name, i))
+		}
+
+		out, err := run(s.Steps, ctx)
+		outputs[i] = out
+		if err != nil {
+			return errors.Wrapf(err, "iteration %d failed", i)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return StepStringOutput{String: "foreach step failed"}, errors.Wrapf(err, "`foreach` steps failed")
+	}
+
+	results := make([]interface{}, len(outputs))
+	lines := []string{}
+	for i, out := range outputs {
+		results[i] = out.String
+		if out.String != "" {
+			lines = append(lines, out.String)
+		}
+	}
+
+	output := StepStringOutput{String: strings.Join(lines, "\n")}
+	if s.Name != "" {
+		output.Values = map[string]interface{}{s.Name: results}
+	}
+
+	return output, nil
+}
+
+func (s ForeachStep) GetName() string {
+	return s.Name
+}
+
+func (s ForeachStep) Silenced() bool {
+	return s.Silent
+}
+
+// iterations returns the values to be bound for each run of the steps
+func (s ForeachStep) iterations(context ExecutionContext) ([]map[string]interface{}, error) {
+	if len(s.Matrix) == 0 {
+		items, err := evaluateItems(s.Items, "foreach.items", context)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			result[i] = map[string]interface{}{s.As: item}
+		}
+
+		return result, nil
+	}
+
+	keys := []string{}
+	for k := range s.Matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []map[string]interface{}{{}}
+
+	for _, k := range keys {
+		items, err := evaluateItems(s.Matrix[k], fmt.Sprintf("foreach.matrix.%s", k), context)
+		if err != nil {
+			return nil, err
+		}
+
+		product := []map[string]interface{}{}
+		for _, vs := range result {
+			for _, item := range items {
+				combination := map[string]interface{}{}
+				for k2, v := range vs {
+					combination[k2] = v
+				}
+				combination[k] = item
+				product = append(product, combination)
+			}
+		}
+		result = product
+	}
+
+	return result, nil
+}
+
+func evaluateItems(items interface{}, name string, context ExecutionContext) ([]interface{}, error) {
+	switch v := items.(type) {
+	case string:
+		value, err := context.RenderValue(v, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch ary := value.(type) {
+		case []interface{}:
+			return ary, nil
+		case nil:
+			return []interface{}{}, nil
+		default:
+			return nil, fmt.Errorf("%s must evaluate to an array, but got %v(%T)", name, value, value)
+		}
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			if expr, ok := item.(string); ok {
+				rendered, err := context.Render(expr, fmt.Sprintf("%s[%d]", name, i))
+				if err != nil {
+					return nil, err
+				}
+				item = rendered
+			} else {
+				stringified, err := maputil.RecursivelyStringifyKeysOfAny(item)
+				if err != nil {
+					return nil, err
+				}
+				item = stringified
+			}
+			result[i] = item
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("%s must be either an array or a template expression, but got %v(%T)", name, items, items)
+	}
+}
@@ -0,0 +1,276 @@
+package variant
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bgentry/go-netrc/netrc"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+type HTTPStepLoader struct{}
+
+func (l HTTPStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	if config.Get("http") == nil {
+		return nil, fmt.Errorf("no field named http exists, config=%v", config)
+	}
+
+	h := NewStepDef(config.GetStringMapOrEmpty("http"))
+
+	result := HTTPStep{
+		Name:    config.GetName(),
+		Method:  http.MethodGet,
+		Headers: map[string]string{},
+		Silent:  config.Silent(),
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *string
+	}{
+		{"method", &result.Method},
+		{"url", &result.URL},
+		{"body", &result.Body},
+	} {
+		switch v := h.Get(f.key).(type) {
+		case string:
+			*f.dst = v
+		case nil:
+		default:
+			return nil, fmt.Errorf("field \"http.%s\" must be a string but it wasn't: %v", f.key, v)
+		}
+	}
+
+	if result.URL == "" {
+		return nil, fmt.Errorf("field \"http.url\" must be specified: %v", config.Get("http"))
+	}
+
+	for k, v := range h.GetStringMapOrEmpty("headers") {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("field \"http.headers.%s\" must be a string but it wasn't: %v", k, v)
+		}
+		result.Headers[k] = s
+	}
+
+	switch v := h.Get("expectedStatus").(type) {
+	case int:
+		result.ExpectedStatus = []int{v}
+	case []interface{}:
+		for _, s := range v {
+			code, ok := s.(int)
+			if !ok {
+				return nil, fmt.Errorf("field \"http.expectedStatus\" must be an array of integers but it wasn't: %v", v)
+			}
+			result.ExpectedStatus = append(result.ExpectedStatus, code)
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"http.expectedStatus\" must be an integer or an array of integers but it wasn't: %v", v)
+	}
+
+	timeout, err := parseTimeout(h.Get("timeout"))
+	if err != nil {
+		return nil, err
+	}
+	result.Timeout = timeout
+
+	return result, nil
+}
+
+func NewHTTPStepLoader() HTTPStepLoader {
+	return HTTPStepLoader{}
+}
+
+// HTTPStep sends a HTTP request and outputs the response body.
+// The body is available to subsequent steps as `.<name>` like any other step output, and
+// the status code, the body and the body parsed as JSON as `.<name>_response.status`, `.<name>_response.body` and `.<name>_response.json` respectively
+type HTTPStep struct {
+	Name    string
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	// ExpectedStatus is the list of status codes considered successful. Any 2xx is successful when empty
+	ExpectedStatus []int
+	Timeout        time.Duration
+	Silent         bool
+}
+
+func (s HTTPStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	req, err := s.newRequest(context)
+	if err != nil {
+		return StepStringOutput{String: "http error"}, errors.Wrapf(err, "http step failed templating")
+	}
+
+	client := cleanhttp.DefaultClient()
+
+	if s.Timeout > 0 {
+		parent := context.Context()
+		var cancel func()
+		context, cancel = context.withTimeout(s.Timeout)
+		defer cancel()
+
+		out, err := s.do(client, req, context)
+		if err != nil && deadlineExceeded(context.Context()) && !deadlineExceeded(parent) {
+			err = errors.Wrap(newTimeoutError(fmt.Sprintf("http step %s", s.GetName()), s.Timeout), err.Error())
+		}
+		return out, err
+	}
+
+	return s.do(client, req, context)
+}
+
+func (s HTTPStep) do(client *http.Client, req *http.Request, context ExecutionContext) (StepStringOutput, error) {
+	logger := context.taskLogger().WithField("step", s.GetName())
+
+	logger.Debugf("sending %s %s", req.Method, redactURL(req.URL))
+
+	res, err := client.Do(req.WithContext(context.Context()))
+	if err != nil {
+		return StepStringOutput{String: "http error"}, errors.Wrapf(err, "http step failed sending request")
+	}
+	defer res.Body.Close()
+
+	bs, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return StepStringOutput{String: "http error"}, errors.Wrapf(err, "http step failed reading response")
+	}
+	body := strings.TrimRight(string(bs), "\n")
+
+	logger.Debugf("received %s", res.Status)
+
+	if !s.expected(res.StatusCode) {
+		return StepStringOutput{String: body}, fmt.Errorf("http step failed: %s %s returned unexpected status %s", req.Method, redactURL(req.URL), res.Status)
+	}
+
+	result := map[string]interface{}{
+		"status": res.StatusCode,
+		"body":   body,
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(bs, &parsed); err == nil {
+		result["json"] = parsed
+	} else {
+		result["json"] = nil
+	}
+
+	if s.Name == "" {
+		return StepStringOutput{String: body}, nil
+	}
+
+	return StepStringOutput{String: body, Values: map[string]interface{}{s.Name + "_response": result}}, nil
+}
+
+func (s HTTPStep) newRequest(context ExecutionContext) (*http.Request, error) {
+	method, err := context.Render(s.Method, "http.method")
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := context.Render(s.URL, "http.url")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := context.Render(s.Body, "http.body")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), u, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for k := range s.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, err := context.Render(s.Headers[k], fmt.Sprintf("http.headers.%s", k))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+
+	if req.Header.Get("Authorization") == "" && req.URL.User == nil {
+		m, err := findNetrcMachine(req.URL.Hostname())
+		if err != nil {
+			context.taskLogger().Warnf("ignored .netrc: %v", err)
+		} else if m != nil {
+			req.SetBasicAuth(m.Login, m.Password)
+		}
+	}
+
+	return req, nil
+}
+
+func (s HTTPStep) expected(status int) bool {
+	if len(s.ExpectedStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, code := range s.ExpectedStatus {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (s HTTPStep) GetName() string {
+	return s.Name
+}
+
+func (s HTTPStep) Silenced() bool {
+	return s.Silent
+}
+
+// findNetrcMachine returns the credentials for the host in the file at $NETRC or ~/.netrc, if any
+func findNetrcMachine(host string) (*netrc.Machine, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	m, err := netrc.FindMachine(path, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing %s", path)
+	}
+
+	return m, nil
+}
+
+// redactURL returns the url with the password replaced so that it can be logged safely
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	c := *u
+	if _, ok := c.User.Password(); ok {
+		c.User = url.UserPassword(c.User.Username(), "xxxxx")
+	}
+	return c.String()
+}
@@ -0,0 +1,162 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestExecutionContext(values map[string]interface{}) ExecutionContext {
+	task := &Task{Name: TaskName{Components: []string{"app", "fetch"}}}
+	runner := TaskRunner{Task: task}
+	return NewStepExecutionContext(context.Background(), Application{Name: "app"}, runner, NewTaskTemplate(task, values), false, nil)
+}
+
+func TestHTTPStep(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/json":
+			fmt.Fprintf(w, `{"method":%q,"token":%q,"body":%q}`, r.Method, r.Header.Get("X-Token"), string(body))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "not found")
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(w, "slow")
+		default:
+			fmt.Fprint(w, "plain")
+		}
+	}))
+	defer server.Close()
+
+	ctx := newTestExecutionContext(map[string]interface{}{"url": server.URL, "token": "secret"})
+
+	t.Run("json", func(t *testing.T) {
+		step := HTTPStep{
+			Name:    "res",
+			Method:  "post",
+			URL:     "{{ .url }}/json",
+			Headers: map[string]string{"X-Token": "{{ .token }}"},
+			Body:    "hello",
+		}
+		out, err := step.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := `{"method":"POST","token":"secret","body":"hello"}`
+		if out.String != expected {
+			t.Errorf("unexpected output: expected %s, got %s", expected, out.String)
+		}
+		res := out.Values["res_response"].(map[string]interface{})
+		if res["status"] != 200 {
+			t.Errorf("unexpected status: %v", res["status"])
+		}
+		if m, ok := res["json"].(map[string]interface{}); !ok || m["token"] != "secret" {
+			t.Errorf("unexpected json: %v", res["json"])
+		}
+	})
+
+	t.Run("name is bound to the body", func(t *testing.T) {
+		step := HTTPStep{Name: "res", Method: "GET", URL: server.URL}
+		out, err := step.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		next, err := ctx.withStepOutput(step, out).Render("{{ .res }} {{ .res_response.status }}", "test")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if next != "plain 200" {
+			t.Errorf("unexpected rendering: %s", next)
+		}
+	})
+
+	t.Run("unnamed", func(t *testing.T) {
+		out, err := HTTPStep{Method: "GET", URL: server.URL}.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if out.Values != nil {
+			t.Errorf("unexpected values: %v", out.Values)
+		}
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		out, err := HTTPStep{Name: "res", Method: "GET", URL: server.URL}.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res := out.Values["res_response"].(map[string]interface{})
+		if res["body"] != "plain" || res["json"] != nil {
+			t.Errorf("unexpected result: %v", res)
+		}
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		_, err := HTTPStep{Name: "res", Method: "GET", URL: server.URL + "/missing"}.Run(ctx)
+		if err == nil {
+			t.Fatalf("expected error, but succeeded")
+		}
+	})
+
+	t.Run("expected status", func(t *testing.T) {
+		out, err := HTTPStep{Name: "res", Method: "GET", URL: server.URL + "/missing", ExpectedStatus: []int{404}}.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if out.String != "not found" {
+			t.Errorf("unexpected output: %s", out.String)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, err := HTTPStep{Name: "res", Method: "GET", URL: server.URL + "/slow", Timeout: 50 * time.Millisecond}.Run(ctx)
+		if _, ok := rootCause(err).(TimeoutError); !ok {
+			t.Fatalf("expected timeout error, got %T: %v", rootCause(err), err)
+		}
+	})
+}
+
+func TestHTTPStepNetrc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		fmt.Fprintf(w, "%s:%s", user, pass)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "variant-netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(path, []byte("machine 127.0.0.1 login alice password pw\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	prev, set := os.LookupEnv("NETRC")
+	os.Setenv("NETRC", path)
+	defer func() {
+		if set {
+			os.Setenv("NETRC", prev)
+		} else {
+			os.Unsetenv("NETRC")
+		}
+	}()
+
+	out, err := HTTPStep{Name: "res", Method: "GET", URL: server.URL}.Run(newTestExecutionContext(map[string]interface{}{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String != "alice:pw" {
+		t.Errorf("unexpected credentials: %s", out.String)
+	}
+}
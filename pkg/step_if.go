@@ -79,6 +79,10 @@ func (l IfStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, er
 }
 
 func readSteps(input interface{}, context LoadingContext) ([]Step, error) {
+	return readStepsWithDefaultName(input, "or", context)
+}
+
+func readStepsWithDefaultName(input interface{}, kind string, context LoadingContext) ([]Step, error) {
 	steps, ok := input.([]interface{})
 
 	if !ok {
@@ -100,7 +104,7 @@ func readSteps(input interface{}, context LoadingContext) ([]Step, error) {
 		}
 
 		if converted["name"] == "" || converted["name"] == nil {
-			converted["name"] = fmt.Sprintf("or[%d]", i)
+			converted["name"] = fmt.Sprintf("%s[%d]", kind, i)
 		}
 
 		step, loadingErr := context.LoadStep(NewStepDef(converted))
@@ -137,9 +141,7 @@ func run(steps []Step, context ExecutionContext) (StepStringOutput, error) {
 			return StepStringOutput{String: "run error"}, errors.Wrapf(lastError, "failed running step")
 		}
 
-		if s.GetName() != "" {
-			context = context.WithAdditionalValues(map[string]interface{}{s.GetName(): lastOutput.String})
-		}
+		context = context.withStepOutput(s, lastOutput)
 	}
 
 	return lastOutput, nil
@@ -0,0 +1,162 @@
+package variant
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+type ParallelStepLoader struct{}
+
+func (l ParallelStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	data := config.Get("parallel")
+
+	if data == nil {
+		return nil, fmt.Errorf("no field named parallel exists, config=%v", config)
+	}
+
+	steps, err := readStepsWithDefaultName(data, "parallel", context)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading `parallel` failed")
+	}
+
+	result := ParallelStep{
+		Name:     config.GetName(),
+		Steps:    steps,
+		FailFast: true,
+		Silent:   config.Silent(),
+	}
+
+	switch v := config.Get("maxConcurrency").(type) {
+	case int:
+		result.MaxConcurrency = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"maxConcurrency\" must be an integer but it wasn't: %v", v)
+	}
+
+	switch v := config.Get("failFast").(type) {
+	case bool:
+		result.FailFast = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"failFast\" must be a boolean but it wasn't: %v", v)
+	}
+
+	return result, nil
+}
+
+func NewParallelStepLoader() ParallelStepLoader {
+	return ParallelStepLoader{}
+}
+
+type ParallelStep struct {
+	Name           string
+	Steps          []Step
+	MaxConcurrency int
+	FailFast       bool
+	Silent         bool
+}
+
+func (s ParallelStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	outputs := make([]StepStringOutput, len(s.Steps))
+	failed := make([]bool, len(s.Steps))
+
+	err := runConcurrently(len(s.Steps), s.MaxConcurrency, s.FailFast, func(i int) error {
+		step := s.Steps[i]
+
+		out, err := step.Run(context.withOutputPrefix(step.GetName()))
+		outputs[i] = out
+		if err != nil {
+			failed[i] = true
+			return errors.Wrapf(err, "step %q failed", step.GetName())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		// Return outputs from the failed steps only, so that the user can see why it failed
+		causes := []string{}
+		for i := range s.Steps {
+			if failed[i] && outputs[i].String != "" {
+				causes = append(causes, outputs[i].String)
+			}
+		}
+		return StepStringOutput{String: strings.Join(causes, "\n")}, errors.Wrapf(err, "`parallel` steps failed")
+	}
+
+	values := map[string]interface{}{}
+	lines := []string{}
+	for i, step := range s.Steps {
+		out := outputs[i]
+		if step.GetName() != "" {
+			values[step.GetName()] = out.String
+		}
+		for k, v := range out.Values {
+			values[k] = v
+		}
+		if !step.Silenced() && out.String != "" {
+			lines = append(lines, out.String)
+		}
+	}
+
+	return StepStringOutput{String: strings.Join(lines, "\n"), Values: values}, nil
+}
+
+func (s ParallelStep) GetName() string {
+	return s.Name
+}
+
+func (s ParallelStep) Silenced() bool {
+	return s.Silent
+}
+
+// runConcurrently calls f for every index in [0, n) with at most maxConcurrency calls in flight at a time.
+// maxConcurrency less than or equal to zero means no limit.
+// When failFast is true, no more calls are started once any call failed.
+func runConcurrently(n int, maxConcurrency int, failFast bool, f func(i int) error) error {
+	if maxConcurrency <= 0 || maxConcurrency > n {
+		maxConcurrency = n
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs *multierror.Error
+
+	sem := make(chan struct{}, maxConcurrency)
+
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+
+		mutex.Lock()
+		failed := errs != nil
+		mutex.Unlock()
+
+		if failFast && failed {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := f(i); err != nil {
+				mutex.Lock()
+				errs = multierror.Append(errs, err)
+				mutex.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return errs.ErrorOrNil()
+}
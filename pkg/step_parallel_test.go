@@ -0,0 +1,78 @@
+package variant
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyRecorder records the calls made by functions run concurrently, and how many of them ran at once
+type concurrencyRecorder struct {
+	mutex   sync.Mutex
+	running int
+	max     int
+	order   []int
+}
+
+// run records the call, and fails when i is failAt
+func (r *concurrencyRecorder) run(i, failAt int) error {
+	r.mutex.Lock()
+	r.order = append(r.order, i)
+	r.running++
+	if r.running > r.max {
+		r.max = r.running
+	}
+	r.mutex.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	r.mutex.Lock()
+	r.running--
+	r.mutex.Unlock()
+
+	if i == failAt {
+		return fmt.Errorf("simulated error")
+	}
+	return nil
+}
+
+func TestRunConcurrently(t *testing.T) {
+	testcases := []struct {
+		n              int
+		maxConcurrency int
+		failFast       bool
+		failAt         int
+		expectedMax    int
+		expectedCalls  int
+	}{
+		{n: 4, maxConcurrency: 0, failAt: -1, expectedMax: 4, expectedCalls: 4},
+		{n: 4, maxConcurrency: 2, failAt: -1, expectedMax: 2, expectedCalls: 4},
+		{n: 4, maxConcurrency: 1, failFast: true, failAt: 1, expectedMax: 1, expectedCalls: 2},
+		{n: 4, maxConcurrency: 1, failFast: false, failAt: 1, expectedMax: 1, expectedCalls: 4},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			r := &concurrencyRecorder{}
+
+			err := runConcurrently(tc.n, tc.maxConcurrency, tc.failFast, func(i int) error {
+				return r.run(i, tc.failAt)
+			})
+
+			if tc.failAt >= 0 && err == nil {
+				t.Fatalf("expected error, but succeeded")
+			}
+			if tc.failAt < 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.max != tc.expectedMax {
+				t.Errorf("unexpected max concurrency: expected %d, got %d", tc.expectedMax, r.max)
+			}
+			if len(r.order) != tc.expectedCalls {
+				t.Errorf("unexpected number of calls: expected %d, got %d", tc.expectedCalls, len(r.order))
+			}
+		})
+	}
+}
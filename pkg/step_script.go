@@ -2,20 +2,26 @@ package variant
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"github.com/google/uuid"
+	"github.com/mattn/go-shellwords"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
 	"archive/tar"
 	"compress/gzip"
 
 	"io"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
+	"sort"
 )
 
 type ScriptStepLoader struct{}
@@ -23,6 +29,17 @@ type ScriptStepLoader struct{}
 func (l ScriptStepLoader) LoadStep(def StepDef, context LoadingContext) (Step, error) {
 	script, isStr := def.Script()
 
+	if scriptFile, ok := def.Get("scriptFile").(string); ok {
+		if isStr {
+			return nil, invalidStepError{fmt.Errorf("both script and scriptFile exist in step %q", def.GetName())}
+		}
+		s, err := readScriptFile(context.BaseDir(), scriptFile)
+		if err != nil {
+			return nil, invalidStepError{errors.Wrapf(err, "failed loading script step %q", def.GetName())}
+		}
+		script, isStr = s, true
+	}
+
 	var runConf *RunnerConfig
 	{
 		runner, ok := def.Get("runner").(map[string]interface{})
@@ -106,14 +123,29 @@ func (l ScriptStepLoader) LoadStep(def StepDef, context LoadingContext) (Step, e
 	log.Debugf("step config: %v", def)
 
 	if isStr && script != "" {
+		timeout, err := parseTimeout(def.Get("timeout"))
+		if err != nil {
+			return nil, err
+		}
 		step := ScriptStep{
-			Name:   def.GetName(),
-			Code:   script,
-			Silent: def.Silent(),
+			Name:    def.GetName(),
+			Code:    script,
+			Silent:  def.Silent(),
+			Timeout: timeout,
 		}
 		if runConf != nil {
 			step.RunnerConfig = *runConf
 		}
+		switch v := def.Get("template").(type) {
+		case bool:
+			step.NoTemplate = !v
+		case nil:
+		default:
+			return nil, fmt.Errorf("field \"template\" must be a boolean but it wasn't: %v", v)
+		}
+		if err := step.LocalConfig.load(def.Raw()); err != nil {
+			return nil, errors.Wrapf(err, "failed loading script step %q", step.Name)
+		}
 		return step, nil
 	}
 
@@ -124,11 +156,109 @@ func NewScriptStepLoader() ScriptStepLoader {
 	return ScriptStepLoader{}
 }
 
+// readScriptFile reads the script from the file relative to the Variantfile, or the imported source it is defined in
+func readScriptFile(baseDir, path string) (string, error) {
+	resolved := path
+	if !filepath.IsAbs(path) {
+		resolved = filepath.Join(baseDir, path)
+	}
+
+	bs, err := ioutil.ReadFile(resolved)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("script file %q does not exist at %s", path, resolved)
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed reading script file %q", path)
+	}
+
+	return string(bs), nil
+}
+
 type ScriptStep struct {
 	Name         string
 	Code         string
 	Silent       bool
 	RunnerConfig RunnerConfig
+	LocalConfig  LocalConfig
+	Timeout      time.Duration
+	// NoTemplate runs the script as-is, without rendering it as a template
+	NoTemplate bool
+}
+
+// LocalConfig is how scripts are run without docker.
+// Unlike autoenv, the settings are applied only to the script's process and never leak into variant itself
+type LocalConfig struct {
+	// Env is the map of environment variables added to the script's environment. Values are templates
+	Env map[string]string `yaml:"env,omitempty"`
+	// Dir is the template rendered into the working directory of the script
+	Dir string `yaml:"dir,omitempty"`
+	// Shell is the command line to run the script with, like `bash -eu` or `python3`. The script is passed as a file
+	Shell string `yaml:"shell,omitempty"`
+}
+
+func (c *LocalConfig) load(raw map[string]interface{}) error {
+	switch env := raw["env"].(type) {
+	case map[interface{}]interface{}:
+		c.Env = make(map[string]string, len(env))
+		for k, v := range env {
+			c.Env[fmt.Sprintf("%v", k)] = fmt.Sprintf("%v", v)
+		}
+	case map[string]interface{}:
+		c.Env = make(map[string]string, len(env))
+		for k, v := range env {
+			c.Env[k] = fmt.Sprintf("%v", v)
+		}
+	case nil:
+	default:
+		return fmt.Errorf("field \"env\" must be a map but it wasn't: %v", env)
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *string
+	}{
+		{"dir", &c.Dir},
+		{"shell", &c.Shell},
+	} {
+		switch v := raw[f.key].(type) {
+		case string:
+			*f.dst = v
+		case nil:
+		default:
+			return fmt.Errorf("field %q must be a string but it wasn't: %v", f.key, v)
+		}
+	}
+
+	return nil
+}
+
+// merge returns the config whose settings are overridden by the other's
+func (c LocalConfig) merge(other LocalConfig) LocalConfig {
+	merged := LocalConfig{Dir: c.Dir, Shell: c.Shell}
+	if len(c.Env) > 0 || len(other.Env) > 0 {
+		merged.Env = map[string]string{}
+		for k, v := range c.Env {
+			merged.Env[k] = v
+		}
+		for k, v := range other.Env {
+			merged.Env[k] = v
+		}
+	}
+	if other.Dir != "" {
+		merged.Dir = other.Dir
+	}
+	if other.Shell != "" {
+		merged.Shell = other.Shell
+	}
+	return merged
+}
+
+// localConfig returns the task's local config overridden by the step's
+func (s ScriptStep) localConfig(context ExecutionContext) LocalConfig {
+	if context.taskRunner.Task == nil {
+		return s.LocalConfig
+	}
+	t := context.taskRunner.TaskDef
+	return LocalConfig{Env: t.Env, Dir: t.Dir, Shell: t.Shell}.merge(s.LocalConfig)
 }
 
 type Artifact struct {
@@ -150,7 +280,7 @@ type RunnerConfig struct {
 	Workdir    string
 }
 
-func (c RunnerConfig) commandNameAndArgsToRunScript(script string, context ExecutionContext) (string, []string) {
+func (c RunnerConfig) commandNameAndArgsToRunScript(script string, containerName string, context ExecutionContext) (string, []string) {
 	var cmd string
 	if c.Command != "" {
 		cmd = c.Command
@@ -193,12 +323,40 @@ tar zxvf %s.tgz 1>&2
 			}
 		}
 
+		// The container receives the environment variables allowed by the policy, in addition to the ones configured for the runner
+		containerEnv := map[string]string{}
+		if policy := context.envPolicy(); policy != nil {
+			for k, v := range policy.hostEnv() {
+				if policy.allows(k) {
+					containerEnv[k] = v
+				}
+			}
+			if !policy.inherits() {
+				inputsEnv, err := context.inputsEnv()
+				if err != nil {
+					log.Errorf("script step failed to generate env from inputs with docker run: %v", err)
+				}
+				for k, v := range inputsEnv {
+					containerEnv[k] = v
+				}
+			}
+		}
+		for k, v := range c.Env {
+			containerEnv[k] = os.ExpandEnv(v)
+		}
+		context.printEnv("container", containerEnv)
+
 		dockerArgs := []string{}
 		for _, v := range c.Volumes {
 			dockerArgs = append(dockerArgs, "-v", os.ExpandEnv(v))
 		}
-		for k, v := range c.Env {
-			dockerArgs = append(dockerArgs, "-e", fmt.Sprintf("%s=%s", k, os.ExpandEnv(v)))
+		envNames := make([]string, 0, len(containerEnv))
+		for k := range containerEnv {
+			envNames = append(envNames, k)
+		}
+		sort.Strings(envNames)
+		for _, k := range envNames {
+			dockerArgs = append(dockerArgs, "-e", fmt.Sprintf("%s=%s", k, containerEnv[k]))
 		}
 		if c.Envfile != "" {
 			dockerArgs = append(dockerArgs, "--env-file", os.ExpandEnv(c.Envfile))
@@ -212,6 +370,9 @@ tar zxvf %s.tgz 1>&2
 		if c.Workdir != "" {
 			dockerArgs = append(dockerArgs, "--workdir", c.Workdir)
 		}
+		if containerName != "" {
+			dockerArgs = append(dockerArgs, "--name", containerName)
+		}
 		var args []string
 		args = append(args, dockerArgs...)
 		args = append(args, c.Image)
@@ -235,10 +396,27 @@ func (s ScriptStep) GetName() string {
 func (s ScriptStep) Run(context ExecutionContext) (StepStringOutput, error) {
 	depended := len(context.Caller()) > 0
 
-	script, err := context.Render(s.Code, s.GetName())
-	if err != nil {
-		log.WithFields(log.Fields{"source": s.Code, "vars": context.Vars}).Errorf("script step failed templating")
-		return StepStringOutput{String: "scripterror"}, errors.Wrapf(err, "script step failed templating")
+	script := s.Code
+	if !s.NoTemplate {
+		var err error
+		script, err = context.Render(s.Code, s.GetName())
+		if err != nil {
+			log.WithFields(log.Fields{"source": s.Code, "vars": context.Vars}).Errorf("script step failed templating")
+			return StepStringOutput{String: "scripterror"}, errors.Wrapf(err, "script step failed templating")
+		}
+	}
+
+	if s.Timeout > 0 {
+		parent := context.Context()
+		var cancel func()
+		context, cancel = context.withTimeout(s.Timeout)
+		defer cancel()
+
+		output, err := s.runScriptWithArtifacts(script, depended, context)
+		if err != nil && deadlineExceeded(context.Context()) && !deadlineExceeded(parent) {
+			err = errors.Wrap(newTimeoutError(fmt.Sprintf("script step %s", s.GetName()), s.Timeout), err.Error())
+		}
+		return StepStringOutput{String: output}, err
 	}
 
 	output, err := s.runScriptWithArtifacts(script, depended, context)
@@ -257,37 +435,122 @@ func (t ScriptStep) runScriptWithArtifacts(script string, depended bool, context
 			return "", err
 		}
 		setup := fmt.Sprintf(`aws s3 cp %s.tgz %s/%s.tgz 1>&2`, a.Name, via, a.Name)
-		name, args := RunnerConfig{}.commandNameAndArgsToRunScript(setup, context)
-		out, err := t.runCommand(name, args, depended, context)
+		name, args := RunnerConfig{}.commandNameAndArgsToRunScript(setup, "", context)
+		// The exit codes of the task apply only to the script, not to the setup uploading artifacts
+		out, err := t.runCommand(name, args, "", depended, nil, context)
 		if err != nil {
 			return out, err
 		}
 	}
 
-	name, args := t.RunnerConfig.commandNameAndArgsToRunScript(script, context)
-	output, err := t.runCommand(name, args, depended, context)
+	// Name the container so that it can be killed along with the `docker run` process on timeout
+	var containerName string
+	if t.RunnerConfig.Image != "" {
+		containerName = fmt.Sprintf("variant-%s", uuid.New().String())
+	}
+
+	if t.runsFromFile(script, context) {
+		return t.runScriptFile(script, depended, context)
+	}
+
+	name, args := t.RunnerConfig.commandNameAndArgsToRunScript(script, containerName, context)
+	output, err := t.runCommand(name, args, containerName, depended, context.taskRunner.ExitCodes, context)
 	if err != nil {
 		return output, err
 	}
 	return output, nil
 }
 
-func (t ScriptStep) runCommand(name string, args []string, depended bool, context ExecutionContext) (string, error) {
+// runsFromFile returns true when the script is run locally by the shell or the interpreter specified in its shebang line,
+// rather than being passed to `bash -c`
+func (t ScriptStep) runsFromFile(script string, context ExecutionContext) bool {
+	r := t.RunnerConfig
+	if r.Image != "" || r.Command != "" || r.Args != nil || len(r.Artifacts) > 0 {
+		return false
+	}
+	return t.localConfig(context).Shell != "" || strings.HasPrefix(strings.TrimLeft(script, " \t\r\n"), "#!")
+}
+
+// runScriptFile writes the script to a temporary file and runs it with the shell, or the interpreter in its shebang line.
+// The file is removed once the script exits
+func (t ScriptStep) runScriptFile(script string, depended bool, context ExecutionContext) (string, error) {
+	script = strings.TrimLeft(script, " \t\r\n")
+
+	var command []string
+	if shell := t.localConfig(context).Shell; shell != "" {
+		words, err := shellwords.Parse(shell)
+		if err != nil || len(words) == 0 {
+			return "", fmt.Errorf("script step failed parsing shell %q: %v", shell, err)
+		}
+		command = words
+	} else {
+		command = parseShebang(script)
+		if command[0] == "" {
+			return "", fmt.Errorf("script step failed: no interpreter specified in the shebang line")
+		}
+	}
+
+	f, err := ioutil.TempFile("", "variant-script-")
+	if err != nil {
+		return "", errors.Wrapf(err, "script step failed creating script file")
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	if _, err := f.WriteString(script); err != nil {
+		f.Close()
+		return "", errors.Wrapf(err, "script step failed writing script file")
+	}
+	if err := f.Close(); err != nil {
+		return "", errors.Wrapf(err, "script step failed writing script file")
+	}
+
+	context.taskLogger().Debugf("script step wrote script to %s", path)
+
+	// The interpreter is run with the path rather than executing the file, to avoid "text file busy" errors
+	// when another goroutine forks while the file is open for writing
+	return t.runCommand(command[0], append(command[1:], path), "", depended, context.taskRunner.ExitCodes, context)
+}
+
+// parseShebang returns the interpreter and its optional argument specified in the first line of the script.
+// Like the kernel does, everything after the interpreter is passed as a single argument
+func parseShebang(script string) []string {
+	line := strings.SplitN(strings.TrimPrefix(script, "#!"), "\n", 2)[0]
+	parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(parts) == 2 {
+		if arg := strings.TrimSpace(parts[1]); arg != "" {
+			return []string{parts[0], arg}
+		}
+	}
+	return parts[:1]
+}
+
+// ScriptError is returned when a script exited unsuccessfully
+type ScriptError struct {
+	error
+	ExitStatus int
+	Stderr     string
+}
+
+// runCommand runs the command, translating its exit status with exitCodes
+func (t ScriptStep) runCommand(name string, args []string, containerName string, depended bool, exitCodes map[int]int, context ExecutionContext) (string, error) {
 	applog := log.StandardLogger().WithField("app", context.app.Name)
 	taskKey := context.Key().ShortString()
-	tasklog := applog.WithField("task", taskKey)
+	tasklog := context.taskLogger()
 
 	applog.Infof("starting task %s", taskKey)
 	tasklog.Debugf("starting command %s %s", name, strings.TrimSuffix(strings.Join(args, " "), "\n"))
 
 	cmd := exec.Command(name, args...)
 
-	mergedEnv := map[string]string{}
+	// Run the command in its own process group, so that the whole tree of processes can be terminated on timeout or cancellation.
+	// Interactive commands are kept in the foreground process group so that they can read from the terminal
+	if !context.Interactive() {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
 
-	for _, pair := range os.Environ() {
-		splits := strings.SplitN(pair, "=", 2)
-		key, value := splits[0], splits[1]
-		mergedEnv[key] = value
+	if err := context.Context().Err(); err != nil {
+		return "", errors.Wrap(err, "script step cancelled")
 	}
 
 	if context.Autodir() {
@@ -305,10 +568,51 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 		}
 	}
 
+	if t.RunnerConfig.Image == "" {
+		local := t.localConfig(context)
+
+		if local.Dir != "" {
+			dir, err := context.Render(local.Dir, "dir")
+			if err != nil {
+				return "", errors.Wrapf(err, "script step failed templating dir")
+			}
+			cmd.Dir = dir
+		}
+
+		policy := context.envPolicy()
+		mergedEnv := policy.hostEnv()
+
+		if !policy.inherits() {
+			inputsEnv, err := context.inputsEnv()
+			if err != nil {
+				return "", errors.Wrapf(err, "script step failed generating env from inputs")
+			}
+			for k, v := range inputsEnv {
+				mergedEnv[k] = v
+			}
+		}
+
+		for k, v := range local.Env {
+			rendered, err := context.Render(v, fmt.Sprintf("env.%s", k))
+			if err != nil {
+				return "", errors.Wrapf(err, "script step failed templating env %s", k)
+			}
+			mergedEnv[k] = rendered
+		}
+
+		cmd.Env = make([]string, 0, len(mergedEnv))
+		for k, v := range mergedEnv {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+
+		context.printEnv(fmt.Sprintf("step %s", t.GetName()), mergedEnv)
+	}
+
 	errOut := ""
 	resOut := ""
 
 	var done chan struct{}
+	var stopTerminator func()
 
 	if context.Interactive() {
 		cmd.Stdin = os.Stdin
@@ -320,6 +624,7 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 			fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
 			os.Exit(1)
 		}
+		stopTerminator = terminateOnDone(context.Context(), cmd, containerName, context.app.GracePeriod, tasklog)
 	} else {
 		done = make(chan struct{})
 		defer func() {
@@ -342,6 +647,7 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 			fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
 			os.Exit(1)
 		}
+		stopTerminator = terminateOnDone(context.Context(), cmd, containerName, context.app.GracePeriod, tasklog)
 
 		// Receive stdout and stderr
 
@@ -386,20 +692,26 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 		var writeToOut func(str string)
 		var writeToErr func(str string)
 
+		// Prefix lines so that outputs from steps running in parallel don't get mixed up
+		var prefix string
+		if context.app.outputPrefix != "" {
+			prefix = fmt.Sprintf("[%s] ", context.app.outputPrefix)
+		}
+
 		// Print logs to stdout and stderr only when this is the command called by the user, directly or indirectly, as a task script. not as an input
 		if !context.asInput {
 			writeToOut = func(str string) {
-				fmt.Fprint(os.Stdout, str, "\n")
+				fmt.Fprint(os.Stdout, prefix+str+"\n")
 			}
 			writeToErr = func(str string) {
-				tasklog.Warn(str)
+				tasklog.Warn(prefix + str)
 			}
 		} else {
 			writeToOut = func(str string) {
-				tasklog.Info(str)
+				tasklog.Info(prefix + str)
 			}
 			writeToErr = func(str string) {
-				tasklog.Warn(str)
+				tasklog.Warn(prefix + str)
 			}
 		}
 
@@ -441,6 +753,7 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 
 	var waitStatus syscall.WaitStatus
 	err := cmd.Wait()
+	stopTerminator()
 
 	if done != nil {
 		log.Debugf("waiting for all the stdout/stderr contents to be consumed...in case this hangs, file a bug report.")
@@ -451,13 +764,25 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 	}
 
 	if err != nil {
-		tasklog.Errorf("script step failed: %v", err)
+		scriptErr := ScriptError{error: err, ExitStatus: -1, Stderr: strings.Trim(errOut, "\n ")}
 		// Did the command fail because of an unsuccessful exit code
 		if exitError, ok := err.(*exec.ExitError); ok {
 			waitStatus = exitError.Sys().(syscall.WaitStatus)
-			log.Errorf("exit status was %d", waitStatus.ExitStatus())
+			scriptErr.ExitStatus = waitStatus.ExitStatus()
+
+			if translated, ok := exitCodes[scriptErr.ExitStatus]; ok {
+				tasklog.Debugf("exit status %d translated to %d", scriptErr.ExitStatus, translated)
+				if translated == 0 {
+					return strings.Trim(resOut, "\n "), nil
+				}
+				scriptErr.ExitStatus = translated
+			}
 		}
-		return strings.Trim(errOut, "\n "), errors.Wrap(err, "script step failed")
+		tasklog.Errorf("script step failed: %v", err)
+		if scriptErr.ExitStatus >= 0 {
+			log.Errorf("exit status was %d", scriptErr.ExitStatus)
+		}
+		return scriptErr.Stderr, errors.Wrap(scriptErr, "script step failed")
 	} else {
 		// Command was successful
 		waitStatus = cmd.ProcessState.Sys().(syscall.WaitStatus)
@@ -467,6 +792,61 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 	return strings.Trim(resOut, "\n "), nil
 }
 
+// terminateOnDone signals the command along with its child processes, and the container run by it if any, once the context is done.
+// The signal is the one received by variant, or SIGTERM on timeout. Processes still running after the grace period are killed,
+// and a zero grace period kills them right away.
+// The returned function must be called after the command exited.
+func terminateOnDone(ctx context.Context, cmd *exec.Cmd, containerName string, gracePeriod time.Duration, logger *log.Entry) func() {
+	exited := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			return
+		}
+
+		// A zero grace period kills the command without giving it a chance to exit
+		if gracePeriod <= 0 {
+			logger.Warnf("killing command: %v", ctx.Err())
+			signalCommand(cmd, containerName, syscall.SIGKILL, logger)
+			return
+		}
+
+		sig, ok := signalFromContext(ctx)
+		if !ok {
+			sig = syscall.SIGTERM
+		}
+
+		logger.Warnf("terminating command with %v: %v", sig, ctx.Err())
+		signalCommand(cmd, containerName, sig, logger)
+
+		select {
+		case <-exited:
+		case <-time.After(gracePeriod):
+			logger.Warnf("command didn't exit within %s. killing it", gracePeriod)
+			signalCommand(cmd, containerName, syscall.SIGKILL, logger)
+		}
+	}()
+
+	return func() {
+		close(exited)
+	}
+}
+
+func signalCommand(cmd *exec.Cmd, containerName string, sig syscall.Signal, logger *log.Entry) {
+	if containerName != "" {
+		if out, err := exec.Command("docker", "kill", "--signal", fmt.Sprintf("%d", sig), containerName).CombinedOutput(); err != nil {
+			logger.Debugf("failed signaling container %s: %v: %s", containerName, err, out)
+		}
+	}
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		syscall.Kill(-cmd.Process.Pid, sig)
+	} else {
+		cmd.Process.Signal(sig)
+	}
+}
+
 func createTarFromGlob(filename string, pattern string) error {
 	paths, err := filepath.Glob(pattern)
 	if err != nil {
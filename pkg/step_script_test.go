@@ -0,0 +1,150 @@
+package variant
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLocalConfigMerge(t *testing.T) {
+	task := LocalConfig{Env: map[string]string{"A": "1", "B": "2"}, Dir: "task", Shell: "bash -eu"}
+	step := LocalConfig{Env: map[string]string{"B": "3"}, Dir: "step"}
+
+	expected := LocalConfig{Env: map[string]string{"A": "1", "B": "3"}, Dir: "step", Shell: "bash -eu"}
+	if diff := cmp.Diff(expected, task.merge(step)); diff != "" {
+		t.Errorf("unexpected merge result (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(LocalConfig{}, LocalConfig{}.merge(LocalConfig{})); diff != "" {
+		t.Errorf("unexpected merge result of empty configs (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalConfigLoad(t *testing.T) {
+	var c LocalConfig
+	err := c.load(map[string]interface{}{
+		"env":   map[interface{}]interface{}{"PORT": 8080, "NAME": "{{ .name }}"},
+		"dir":   "sub",
+		"shell": "sh",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := LocalConfig{Env: map[string]string{"PORT": "8080", "NAME": "{{ .name }}"}, Dir: "sub", Shell: "sh"}
+	if diff := cmp.Diff(expected, c); diff != "" {
+		t.Errorf("unexpected config (-want +got):\n%s", diff)
+	}
+
+	if err := c.load(map[string]interface{}{"dir": 1}); err == nil {
+		t.Errorf("expected error for non-string dir, but succeeded")
+	}
+}
+
+func TestParseShebang(t *testing.T) {
+	testcases := map[string][]string{
+		"#!/bin/sh\necho":                  {"/bin/sh"},
+		"#!/usr/bin/env python3\nprint(1)": {"/usr/bin/env", "python3"},
+		"#! /bin/bash -eu \necho":          {"/bin/bash", "-eu"},
+		"#!/usr/bin/env -S node --harmony": {"/usr/bin/env", "-S node --harmony"},
+	}
+
+	for script, expected := range testcases {
+		if diff := cmp.Diff(expected, parseShebang(script)); diff != "" {
+			t.Errorf("unexpected result for %q (-want +got):\n%s", script, diff)
+		}
+	}
+}
+
+func TestReadScriptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-script-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "run.sh"), []byte("echo {{ .x }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := readScriptFile(dir, "run.sh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if script != "echo {{ .x }}\n" {
+		t.Errorf("unexpected script: %q", script)
+	}
+
+	if _, err := readScriptFile(dir, "missing.sh"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected an error for the missing file, got %v", err)
+	}
+}
+
+func TestReadTaskDefResolvesScriptFileAgainstItsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-script-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"Variantfile": "tasks:\n  outer:\n    tasks:\n      inner:\n        scriptFile: run.sh\n",
+		"run.sh":      "echo hello\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	def, err := ReadTaskDefFromFile(filepath.Join(dir, "Variantfile"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s := def.TaskDefs[0].TaskDefs[0].Script; s != "echo hello\n" {
+		t.Errorf("unexpected script of the nested task: %q", s)
+	}
+}
+
+func TestTerminateOnDoneWithZeroGracePeriod(t *testing.T) {
+	// The command ignores SIGTERM, so that it exits only when killed
+	cmd := exec.Command("sh", "-c", "trap '' TERM; sleep 10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := terminateOnDone(ctx, cmd, "", 0, logrus.NewEntry(logrus.StandardLogger()))
+	cancel()
+
+	start := time.Now()
+	cmd.Wait()
+	stop()
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed immediately, but it took %s", elapsed)
+	}
+}
+
+func TestRunCommandTranslatesExitCodes(t *testing.T) {
+	ctx := newTestExecutionContext(map[string]interface{}{})
+
+	if _, err := (ScriptStep{}).runCommand("sh", []string{"-c", "exit 3"}, "", false, map[int]int{3: 0}, ctx); err != nil {
+		t.Errorf("expected the translated exit code to succeed, got %v", err)
+	}
+
+	_, err := (ScriptStep{}).runCommand("sh", []string{"-c", "exit 3"}, "", false, nil, ctx)
+	if scriptErr, ok := errors.Cause(err).(ScriptError); !ok || scriptErr.ExitStatus != 3 {
+		t.Errorf("expected the untranslated exit code 3, got %v", err)
+	}
+}
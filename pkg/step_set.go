@@ -0,0 +1,113 @@
+package variant
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mumoshu/variant/pkg/util/maputil"
+	"github.com/pkg/errors"
+)
+
+type SetStepLoader struct{}
+
+func (l SetStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	if config.Get("set") == nil {
+		return nil, fmt.Errorf("no field named set exists, config=%v", config)
+	}
+
+	result := SetStep{
+		Name:   config.GetName(),
+		Exprs:  map[string]string{},
+		Silent: config.Silent(),
+	}
+
+	for k, v := range config.GetStringMapOrEmpty("set") {
+		expr, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("field \"set.%s\" must be a template expression but it wasn't: %v", k, v)
+		}
+		result.Exprs[k] = expr
+	}
+
+	if len(result.Exprs) == 0 {
+		return nil, fmt.Errorf("field \"set\" must be a non-empty map of template expressions: %v", config.Get("set"))
+	}
+
+	if s := config.Get("schema"); s != nil {
+		schema, err := maputil.RecursivelyStringifyKeys(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field \"schema\" must be a map")
+		}
+		result.Schema = schema
+	}
+
+	return result, nil
+}
+
+func NewSetStepLoader() SetStepLoader {
+	return SetStepLoader{}
+}
+
+// SetStep evaluates the template expressions and makes the results available to the subsequent steps,
+// keeping arrays, maps, numbers and booleans as-is rather than flattening them into strings
+type SetStep struct {
+	Name  string
+	Exprs map[string]string
+	// Schema is the JSON schema the evaluated values must conform to.
+	// A value whose property is typed `string` in the schema is never parsed into other types
+	Schema map[string]interface{}
+	Silent bool
+}
+
+func (s SetStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	keys := make([]string, 0, len(s.Exprs))
+	for k := range s.Exprs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		name := fmt.Sprintf("set.%s", k)
+
+		var v interface{}
+		var err error
+		if s.propertyType(k) == "string" {
+			v, err = context.Render(s.Exprs[k], name)
+		} else {
+			v, err = context.RenderValue(s.Exprs[k], name)
+		}
+		if err != nil {
+			return StepStringOutput{String: "set error"}, errors.Wrapf(err, "set step failed templating %s", k)
+		}
+		values[k] = v
+	}
+
+	if s.Schema != nil {
+		if err := validateJSONSchema(s.Schema, values); err != nil {
+			return StepStringOutput{String: err.Error()}, errors.Wrapf(err, "set step failed validating values")
+		}
+	}
+
+	return StepStringOutput{Values: values}, nil
+}
+
+func (s SetStep) propertyType(key string) interface{} {
+	props, ok := s.Schema["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	prop, ok := props[key].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return prop["type"]
+}
+
+func (s SetStep) GetName() string {
+	return s.Name
+}
+
+func (s SetStep) Silenced() bool {
+	return s.Silent
+}
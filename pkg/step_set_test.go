@@ -0,0 +1,46 @@
+package variant
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetStep(t *testing.T) {
+	ctx := newTestExecutionContext(map[string]interface{}{"env": "prd"})
+
+	step := SetStep{
+		Exprs: map[string]string{
+			"replicas": `{{ if eq .env "prd" }}3{{ else }}1{{ end }}`,
+			"zones":    `[a, b]`,
+			"version":  `1.10`,
+		},
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"version": map[string]interface{}{"type": "string"},
+			},
+		},
+	}
+
+	out, err := step.Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"replicas": 3,
+		"zones":    []interface{}{"a", "b"},
+		"version":  "1.10",
+	}
+	if diff := cmp.Diff(expected, out.Values); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+
+	step.Schema["properties"].(map[string]interface{})["replicas"] = map[string]interface{}{"type": "string"}
+	step.Exprs["replicas"] = `{{ 3 }}`
+	step.Schema["properties"].(map[string]interface{})["zones"] = map[string]interface{}{"type": "integer"}
+	if _, err := step.Run(ctx); err == nil {
+		t.Errorf("expected error for values not conforming to the schema, but succeeded")
+	}
+}
@@ -0,0 +1,166 @@
+package variant
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type SwitchStepLoader struct{}
+
+func (l SwitchStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	subject, ok := config.Get("switch").(string)
+	if !ok {
+		return nil, fmt.Errorf("no field named switch exists, config=%v", config)
+	}
+
+	casesData := config.GetStringMapOrEmpty("cases")
+	if len(casesData) == 0 {
+		return nil, fmt.Errorf("field \"cases\" must be a non-empty map from values to steps: %v", config.Get("cases"))
+	}
+
+	result := SwitchStep{
+		Name:    config.GetName(),
+		Subject: subject,
+		Cases:   []SwitchCase{},
+		Silent:  config.Silent(),
+	}
+
+	values := []string{}
+	for v := range casesData {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	regexCases := []SwitchCase{}
+
+	for _, v := range values {
+		steps, err := readSteps(casesData[v], context)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading `cases.%s` failed", v)
+		}
+
+		c := SwitchCase{Value: v, Steps: steps}
+
+		// Values enclosed in slashes like `/^prd-/` are regular expressions
+		if len(v) > 1 && strings.HasPrefix(v, "/") && strings.HasSuffix(v, "/") {
+			r, err := regexp.Compile(v[1 : len(v)-1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "field \"cases.%s\" must be a valid regular expression", v)
+			}
+			c.Regexp = r
+			regexCases = append(regexCases, c)
+		} else {
+			result.Cases = append(result.Cases, c)
+		}
+	}
+
+	// Exact matches take precedence over regular expressions.
+	// Regular expressions have no precedence among them, as YAML maps are unordered, so the subject matching more than one of them is an error
+	result.Cases = append(result.Cases, regexCases...)
+
+	if defaultData := config.Get("default"); defaultData != nil {
+		steps, err := readSteps(defaultData, context)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading `default` failed")
+		}
+		result.Default = steps
+	}
+
+	return result, nil
+}
+
+func NewSwitchStepLoader() SwitchStepLoader {
+	return SwitchStepLoader{}
+}
+
+type SwitchCase struct {
+	Value string
+	// Regexp is set when the value is a regular expression like `/^prd-/`
+	Regexp *regexp.Regexp
+	Steps  []Step
+}
+
+func (c SwitchCase) matches(subject string) bool {
+	if c.Regexp != nil {
+		return c.Regexp.MatchString(subject)
+	}
+	return c.Value == subject
+}
+
+type SwitchStep struct {
+	Name string
+	// Subject is the template expression whose rendered value is matched against the cases
+	Subject string
+	Cases   []SwitchCase
+	Default []Step
+	Silent  bool
+}
+
+func (s SwitchStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	subject, err := context.Render(s.Subject, "switch")
+	if err != nil {
+		return StepStringOutput{String: "switch error"}, errors.Wrapf(err, "`switch` failed evaluating subject")
+	}
+	subject = strings.TrimSpace(subject)
+
+	matched, err := s.match(subject)
+	if err != nil {
+		return StepStringOutput{String: "switch error"}, err
+	}
+
+	steps := s.Default
+	branch := "default"
+	if matched != nil {
+		steps = matched.Steps
+		branch = matched.Value
+	}
+
+	if steps == nil {
+		context.taskLogger().Debugf("step %s matched no case for %q", s.Name, subject)
+		return StepStringOutput{}, nil
+	}
+
+	out, err := run(steps, context)
+	if err != nil {
+		return StepStringOutput{String: "switch step failed"}, errors.Wrapf(err, "`cases.%s` steps failed", branch)
+	}
+
+	return out, nil
+}
+
+// match returns the case with the value equal to the subject if any, or the only case with the regular expression matching the subject
+func (s SwitchStep) match(subject string) (*SwitchCase, error) {
+	matched := []string{}
+	var result *SwitchCase
+	for i := range s.Cases {
+		c := s.Cases[i]
+		if !c.matches(subject) {
+			continue
+		}
+		if c.Regexp == nil {
+			return &c, nil
+		}
+		if result == nil {
+			result = &c
+		}
+		matched = append(matched, c.Value)
+	}
+
+	if len(matched) > 1 {
+		return nil, fmt.Errorf("`switch` is ambiguous as %q matched more than one case (%s)", subject, strings.Join(matched, ", "))
+	}
+
+	return result, nil
+}
+
+func (s SwitchStep) GetName() string {
+	return s.Name
+}
+
+func (s SwitchStep) Silenced() bool {
+	return s.Silent
+}
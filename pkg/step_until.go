@@ -0,0 +1,146 @@
+package variant
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUntilInterval is how long the until step waits between attempts by default
+const DefaultUntilInterval = 5 * time.Second
+
+type UntilStepLoader struct{}
+
+func (l UntilStepLoader) LoadStep(config StepDef, context LoadingContext) (Step, error) {
+	untilData := config.Get("until")
+	if untilData == nil {
+		return nil, fmt.Errorf("no field named until exists, config=%v", config)
+	}
+
+	result := UntilStep{
+		Name:     config.GetName(),
+		Interval: DefaultUntilInterval,
+		Silent:   config.Silent(),
+	}
+
+	switch v := untilData.(type) {
+	case string:
+		result.Condition = v
+	case []interface{}:
+		steps, err := readStepsWithDefaultName(v, "until", context)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading `until` failed")
+		}
+		result.Steps = steps
+	default:
+		return nil, fmt.Errorf("field \"until\" must be either a template expression or an array of steps but it wasn't: %v", v)
+	}
+
+	if config.Get("interval") != nil {
+		interval, err := parseTimeout(config.Get("interval"))
+		if err != nil {
+			return nil, errors.Wrap(err, "field \"interval\" must be a duration")
+		}
+		result.Interval = interval
+	}
+
+	timeout, err := parseTimeout(config.Get("timeout"))
+	if err != nil {
+		return nil, err
+	}
+	result.Timeout = timeout
+
+	switch v := config.Get("maxAttempts").(type) {
+	case int:
+		result.MaxAttempts = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("field \"maxAttempts\" must be an integer but it wasn't: %v", v)
+	}
+
+	if result.Timeout <= 0 && result.MaxAttempts <= 0 {
+		return nil, fmt.Errorf("either \"timeout\" or \"maxAttempts\" must be specified for the until step %q", result.Name)
+	}
+
+	return result, nil
+}
+
+func NewUntilStepLoader() UntilStepLoader {
+	return UntilStepLoader{}
+}
+
+// UntilStep repeatedly runs the steps until they succeed, or evaluates the condition until it becomes truthy
+type UntilStep struct {
+	Name      string
+	Condition string
+	Steps     []Step
+	Interval  time.Duration
+	// Timeout limits the duration of all the attempts. Zero means no limit
+	Timeout time.Duration
+	// MaxAttempts limits the number of attempts. Zero means no limit
+	MaxAttempts int
+	Silent      bool
+}
+
+func (s UntilStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	if s.Timeout > 0 {
+		var cancel func()
+		context, cancel = context.withTimeout(s.Timeout)
+		defer cancel()
+	}
+
+	logger := context.taskLogger().WithField("step", s.Name)
+
+	for attempt := 1; ; attempt++ {
+		out, done, err := s.attempt(context)
+		if done {
+			logger.Debugf("condition met at attempt %d", attempt)
+			return out, nil
+		}
+
+		if deadlineExceeded(context.Context()) {
+			return StepStringOutput{String: "until step failed"}, errors.Wrapf(newTimeoutError(fmt.Sprintf("until step %s", s.Name), s.Timeout), "condition not met after %d attempts", attempt)
+		} else if context.Context().Err() != nil {
+			return StepStringOutput{String: "until step failed"}, errors.Wrap(context.Context().Err(), "until step cancelled")
+		}
+
+		if s.MaxAttempts > 0 && attempt >= s.MaxAttempts {
+			if err != nil {
+				return StepStringOutput{String: "until step failed"}, errors.Wrapf(err, "condition not met after %d attempts", attempt)
+			}
+			return StepStringOutput{String: "until step failed"}, fmt.Errorf("condition not met after %d attempts", attempt)
+		}
+
+		if err != nil {
+			logger.Infof("attempt %d: condition not met yet. retrying in %s: %v", attempt, s.Interval, err)
+		} else {
+			logger.Infof("attempt %d: condition not met yet. retrying in %s", attempt, s.Interval)
+		}
+
+		select {
+		case <-time.After(s.Interval):
+		case <-context.Context().Done():
+		}
+	}
+}
+
+// attempt returns true when the condition is met
+func (s UntilStep) attempt(context ExecutionContext) (StepStringOutput, bool, error) {
+	if s.Condition != "" {
+		ok, err := evaluateWhen(s.Condition, context)
+		return StepStringOutput{}, ok && err == nil, err
+	}
+
+	out, err := run(s.Steps, context)
+
+	return out, err == nil, err
+}
+
+func (s UntilStep) GetName() string {
+	return s.Name
+}
+
+func (s UntilStep) Silenced() bool {
+	return s.Silent
+}
@@ -9,8 +9,12 @@ type Task struct {
 	Name           TaskName
 	ProjectName    string
 	ResolvedInputs []*Input
-	Tasks          []*Task
-	Command        *cobra.Command
+	// InputDependencies lists the indices of the resolved inputs each resolved input depends on
+	InputDependencies [][]int
+	// ResolvedNeeds is the names of the tasks to be run before the task
+	ResolvedNeeds []TaskName
+	Tasks         []*Task
+	Command       *cobra.Command
 }
 
 func (f Task) GetKey() TaskName {
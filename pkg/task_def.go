@@ -7,23 +7,47 @@ import (
 
 	"github.com/mumoshu/variant/pkg/get"
 	"github.com/mumoshu/variant/pkg/util/maputil"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type TaskDef struct {
-	Name              string       `yaml:"name,omitempty"`
-	Description       string       `yaml:"description,omitempty"`
-	Inputs            InputConfigs `yaml:"inputs,omitempty"`
-	TaskDefs          TaskDefs     `yaml:"tasks,omitempty"`
-	Script            string       `yaml:"script,omitempty"`
-	Steps             []Step       `yaml:"steps,omitempty"`
-	Autoenv           bool         `yaml:"autoenv,omitempty"`
-	Autodir           bool         `yaml:"autodir,omitempty"`
-	BindParamsFromEnv bool         `yaml:"bindParamsFromEnv,omitempty"`
-	Interactive       bool         `yaml:"interactive,omitempty"`
-	Private           bool         `yaml:"private,omitempty"`
+	Name              string            `yaml:"name,omitempty"`
+	Description       string            `yaml:"description,omitempty"`
+	Inputs            InputConfigs      `yaml:"inputs,omitempty"`
+	TaskDefs          TaskDefs          `yaml:"tasks,omitempty"`
+	Script            string            `yaml:"script,omitempty"`
+	Steps             []Step            `yaml:"steps,omitempty"`
+	Autoenv           bool              `yaml:"autoenv,omitempty"`
+	Autodir           bool              `yaml:"autodir,omitempty"`
+	BindParamsFromEnv bool              `yaml:"bindParamsFromEnv,omitempty"`
+	Interactive       bool              `yaml:"interactive,omitempty"`
+	Private           bool              `yaml:"private,omitempty"`
+	Retry             *RetryConfig      `yaml:"retry,omitempty"`
+	Timeout           time.Duration     `yaml:"timeout,omitempty"`
+	ExitCodes         map[int]int       `yaml:"exitCodes,omitempty"`
+	Cleanup           []Step            `yaml:"cleanup,omitempty"`
+	OnFailure         []Step            `yaml:"onFailure,omitempty"`
+	Finally           []Step            `yaml:"finally,omitempty"`
+	Cache             *CacheConfig      `yaml:"cache,omitempty"`
+	Sources           []string          `yaml:"sources,omitempty"`
+	Generates         []string          `yaml:"generates,omitempty"`
+	Needs             []string          `yaml:"needs,omitempty"`
+	When              string            `yaml:"when,omitempty"`
+	Dangerous         bool              `yaml:"dangerous,omitempty"`
+	Env               map[string]string `yaml:"env,omitempty"`
+	EnvPolicy         *EnvPolicy        `yaml:"envPolicy,omitempty"`
+	Dir               string            `yaml:"dir,omitempty"`
+	Shell             string            `yaml:"shell,omitempty"`
 
 	fun func(ctx ExecutionContext) (string, error)
+
+	// stepDefs is the step definitions as written, so that changes to them are detected when checking if the task is up to date
+	stepDefs []interface{}
+	// baseDir is the directory of the file the task is defined in.
+	// Relative paths to files referenced from the task definition, like `scriptFile`, are resolved against it
+	baseDir string
 }
 
 type TaskDefs []*TaskDef
@@ -69,15 +93,33 @@ type TaskDefV2 struct {
 	Parameters  []*ParameterConfig            `yaml:"parameters,omitempty"`
 	Options     []*OptionConfig               `yaml:"options,omitempty"`
 	Import      string                        `yaml:"import,omitempty"`
-	TaskDefs    map[string]*TaskDef           `yaml:"tasks,omitempty"`
+	TaskDefs    map[string]interface{}        `yaml:"tasks,omitempty"`
 	Runner      map[string]interface{}        `yaml:"runner,omitempty"`
 	Script      interface{}                   `yaml:"script,omitempty"`
+	ScriptFile  string                        `yaml:"scriptFile,omitempty"`
+	Template    *bool                         `yaml:"template,omitempty"`
 	StepDefs    []map[interface{}]interface{} `yaml:"steps,omitempty"`
 	Autoenv     bool                          `yaml:"autoenv,omitempty"`
 	Autodir     bool                          `yaml:"autodir,omitempty"`
 	BindEnvVar  bool                          `yaml:"bindParamsFromEnv,omitempty"`
 	Interactive bool                          `yaml:"interactive,omitempty"`
 	Private     bool                          `yaml:"private,omitempty"`
+	Retry       map[string]interface{}        `yaml:"retry,omitempty"`
+	Timeout     interface{}                   `yaml:"timeout,omitempty"`
+	ExitCodes   map[int]int                   `yaml:"exitCodes,omitempty"`
+	Cleanup     []map[interface{}]interface{} `yaml:"cleanup,omitempty"`
+	OnFailure   []map[interface{}]interface{} `yaml:"onFailure,omitempty"`
+	Finally     []map[interface{}]interface{} `yaml:"finally,omitempty"`
+	Cache       interface{}                   `yaml:"cache,omitempty"`
+	Sources     []string                      `yaml:"sources,omitempty"`
+	Generates   []string                      `yaml:"generates,omitempty"`
+	Needs       []string                      `yaml:"needs,omitempty"`
+	When        interface{}                   `yaml:"when,omitempty"`
+	Dangerous   bool                          `yaml:"dangerous,omitempty"`
+	Env         map[string]string             `yaml:"env,omitempty"`
+	EnvPolicy   *EnvPolicy                    `yaml:"envPolicy,omitempty"`
+	Dir         string                        `yaml:"dir,omitempty"`
+	Shell       string                        `yaml:"shell,omitempty"`
 }
 
 func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -97,7 +139,7 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		BindEnvVar:  false,
 		Interactive: false,
 		Inputs:      []*InputConfig{},
-		TaskDefs:    map[string]*TaskDef{},
+		TaskDefs:    map[string]interface{}{},
 		StepDefs:    []map[interface{}]interface{}{},
 	}
 
@@ -105,13 +147,22 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
+	baseDir := t.baseDir
+
 	if v2.Import != "" {
 		log.Debugf("Importing %s", v2.Import)
 
-		err := get.Unmarshal(v2.Import, &v2)
+		path, err := get.GetFile(v2.Import)
 		if err != nil {
 			return err
 		}
+
+		// Relative paths in the imported source are relative to it rather than the importing file
+		baseDir = filepath.Dir(path)
+
+		if err := get.Unmarshal(path, &v2); err != nil {
+			return err
+		}
 	}
 
 	var script string
@@ -126,6 +177,17 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		script = strings.Join(ss, "\n")
 	}
 
+	if v2.ScriptFile != "" {
+		if script != "" {
+			return fmt.Errorf("both script and scriptFile exist")
+		}
+		s, err := readScriptFile(baseDir, v2.ScriptFile)
+		if err != nil {
+			return err
+		}
+		script = s
+	}
+
 	if len(v2.TaskDefs) == 0 && script == "" && len(v2.StepDefs) == 0 {
 		return fmt.Errorf("Not v2 format: `tasks`, `script`, `steps` are missing.")
 	}
@@ -159,18 +221,86 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			t.Inputs = append(t.Inputs, input)
 		}
 	}
-	t.TaskDefs = TransformV2FlowConfigMapToArray(v2.TaskDefs)
-	steps, err := readStepsFromStepDefs(script, v2.Runner, v2.StepDefs)
+	taskDefs := make(map[string]*TaskDef, len(v2.TaskDefs))
+	for name, raw := range v2.TaskDefs {
+		taskDef, err := readTaskDef(raw, baseDir)
+		if err != nil {
+			return errors.Wrapf(err, "Error while reading task %q", name)
+		}
+		taskDefs[name] = taskDef
+	}
+	t.TaskDefs = TransformV2FlowConfigMapToArray(taskDefs)
+	steps, err := readStepsFromStepDefs(baseDir, script, v2.Template, v2.Runner, v2.StepDefs)
 	if err != nil {
 		return errors.Wrapf(err, "Error while reading v2 config")
 	}
 	t.Steps = steps
+	t.stepDefs = make([]interface{}, len(v2.StepDefs))
+	for i := range v2.StepDefs {
+		t.stepDefs[i] = v2.StepDefs[i]
+	}
 	t.Script = script
 	t.Autoenv = v2.Autoenv
 	t.Autodir = v2.Autodir
 	t.BindParamsFromEnv = v2.BindEnvVar
 	t.Interactive = v2.Interactive
 	t.Private = v2.Private
+	if v2.Retry != nil {
+		retry, err := NewRetryConfig(v2.Retry)
+		if err != nil {
+			return errors.Wrapf(err, "Error while reading retry")
+		}
+		t.Retry = retry
+	}
+	timeout, err := parseTimeout(v2.Timeout)
+	if err != nil {
+		return errors.Wrapf(err, "Error while reading timeout")
+	}
+	t.Timeout = timeout
+	t.ExitCodes = v2.ExitCodes
+	cache, err := NewCacheConfig(v2.Cache)
+	if err != nil {
+		return errors.Wrapf(err, "Error while reading cache")
+	}
+	t.Cache = cache
+	t.Sources = v2.Sources
+	t.Generates = v2.Generates
+	t.Needs = v2.Needs
+	t.Dangerous = v2.Dangerous
+	t.Env = v2.Env
+	if err := v2.EnvPolicy.validate(); err != nil {
+		return errors.Wrapf(err, "Error while reading envPolicy")
+	}
+	t.EnvPolicy = v2.EnvPolicy
+	t.Dir = v2.Dir
+	t.Shell = v2.Shell
+	switch when := v2.When.(type) {
+	case string:
+		t.When = when
+	case bool:
+		t.When = fmt.Sprintf("%t", when)
+	case nil:
+	default:
+		return fmt.Errorf("field \"when\" must be a template expression but it wasn't: %v", when)
+	}
+	for _, hook := range []struct {
+		name     string
+		stepDefs []map[interface{}]interface{}
+		dst      *[]Step
+	}{
+		{"cleanup", v2.Cleanup, &t.Cleanup},
+		{"onFailure", v2.OnFailure, &t.OnFailure},
+		{"finally", v2.Finally, &t.Finally},
+	} {
+		if len(hook.stepDefs) == 0 {
+			continue
+		}
+		steps, err := readStepsFromStepDefs(baseDir, "", nil, nil, hook.stepDefs)
+		if err != nil {
+			return errors.Wrapf(err, "Error while reading %s", hook.name)
+		}
+		*hook.dst = steps
+	}
 
 	return nil
 }
@@ -186,6 +316,23 @@ func (t *TaskDef) CopyTo(other *TaskDef) {
 	other.BindParamsFromEnv = t.BindParamsFromEnv
 	other.Interactive = t.Interactive
 	other.Private = t.Private
+	other.Retry = t.Retry
+	other.Timeout = t.Timeout
+	other.ExitCodes = t.ExitCodes
+	other.Cleanup = t.Cleanup
+	other.OnFailure = t.OnFailure
+	other.Finally = t.Finally
+	other.Cache = t.Cache
+	other.Sources = t.Sources
+	other.Generates = t.Generates
+	other.Needs = t.Needs
+	other.When = t.When
+	other.Dangerous = t.Dangerous
+	other.Env = t.Env
+	other.EnvPolicy = t.EnvPolicy
+	other.Dir = t.Dir
+	other.Shell = t.Shell
+	other.stepDefs = t.stepDefs
 }
 
 func (t *TaskDef) Add(args []string, taskDef *TaskDef, f func(ctx ExecutionContext) (string, error)) error {
@@ -240,36 +387,68 @@ func init() {
 	stepLoaders = []StepLoader{}
 }
 
-type stepLoadingContextImpl struct{}
-
-func (s stepLoadingContextImpl) LoadStep(config StepDef) (Step, error) {
-	step, err := LoadStep(config)
-
-	return step, err
+type stepLoadingContextImpl struct {
+	baseDir string
 }
 
-func LoadStep(config StepDef) (Step, error) {
+func (c stepLoadingContextImpl) LoadStep(config StepDef) (Step, error) {
 	var lastError error
 
 	lastError = nil
 
-	context := stepLoadingContextImpl{}
 	for _, loader := range stepLoaders {
 		var s Step
-		s, lastError = loader.LoadStep(config, context)
+		s, lastError = loader.LoadStep(config, c)
 
 		log.WithField("step", s).Debugf("step loaded")
 
+		if invalid, ok := lastError.(invalidStepError); ok {
+			return nil, invalid.error
+		}
+
 		if lastError == nil {
-			return s, nil
+			s, err := withRetry(s, config)
+			if err != nil {
+				return nil, err
+			}
+			return withWhen(s, config)
 		}
 	}
 	return nil, errors.Wrapf(lastError, "all loader failed to load step")
 }
 
-func readStepsFromStepDefs(script string, runner map[string]interface{}, stepDefs []map[interface{}]interface{}) ([]Step, error) {
+func (c stepLoadingContextImpl) BaseDir() string {
+	return c.baseDir
+}
+
+// invalidStepError is returned by a step loader that recognized the step but failed loading it.
+// Unlike other errors, it stops LoadStep from trying the remaining loaders so that the cause isn't masked
+type invalidStepError struct {
+	error
+}
+
+func LoadStep(config StepDef) (Step, error) {
+	return stepLoadingContextImpl{}.LoadStep(config)
+}
+
+func withRetry(s Step, config StepDef) (Step, error) {
+	if config.Get("retry") == nil {
+		return s, nil
+	}
+
+	retry, err := NewRetryConfig(config.GetStringMapOrEmpty("retry"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading retry of step %q", config.GetName())
+	}
+
+	return RetryStep{Step: s, Retry: *retry}, nil
+}
+
+func readStepsFromStepDefs(baseDir string, script string, template *bool, runner map[string]interface{}, stepDefs []map[interface{}]interface{}) ([]Step, error) {
 	result := []Step{}
 
+	context := stepLoadingContextImpl{baseDir: baseDir}
+
 	if script != "" {
 		if len(stepDefs) > 0 {
 			return nil, fmt.Errorf("both script and steps exist.")
@@ -283,7 +462,10 @@ func readStepsFromStepDefs(script string, runner map[string]interface{}, stepDef
 		if runner != nil {
 			raw["runner"] = runner
 		}
-		s, err := LoadStep(NewStepDef(raw))
+		if template != nil {
+			raw["template"] = *template
+		}
+		s, err := context.LoadStep(NewStepDef(raw))
 
 		if err != nil {
 			log.Panicf("step failed to load: %v", err)
@@ -304,7 +486,7 @@ func readStepsFromStepDefs(script string, runner map[string]interface{}, stepDef
 				panic(castErr)
 			}
 
-			s, err := LoadStep(NewStepDef(converted))
+			s, err := context.LoadStep(NewStepDef(converted))
 
 			if err != nil {
 				return nil, errors.Wrapf(err, "Error reading step[%d]", i)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 
@@ -26,9 +27,15 @@ func ReadTaskDefFromString(data string) (*TaskDef, error) {
 }
 
 func ReadTaskDefFromBytes(data []byte) (*TaskDef, error) {
+	return readTaskDefFromBytes(data, "")
+}
+
+// readTaskDefFromBytes reads the task definition, resolving relative paths in it against the baseDir
+func readTaskDefFromBytes(data []byte, baseDir string) (*TaskDef, error) {
 	log.Debugf("%s", string(data))
 
 	c := NewDefaultTaskConfig()
+	c.baseDir = baseDir
 	if err := yaml.Unmarshal(data, c); err != nil {
 		return nil, errors.Wrapf(err, "yaml.Unmarshal failed: %v", err)
 	}
@@ -48,7 +55,7 @@ func ReadTaskDefFromFile(path string) (*TaskDef, error) {
 		return nil, fmt.Errorf("Error while loading %s", path)
 	}
 
-	t, err := ReadTaskDefFromBytes(yamlBytes)
+	t, err := readTaskDefFromBytes(yamlBytes, filepath.Dir(path))
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error while loading %s", path)
@@ -56,3 +63,16 @@ func ReadTaskDefFromFile(path string) (*TaskDef, error) {
 
 	return t, nil
 }
+
+// readTaskDef reads the nested task definition decoded as the raw YAML value, so that it is resolved against the same baseDir as its parent
+func readTaskDef(raw interface{}, baseDir string) (*TaskDef, error) {
+	bs, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "yaml.Marshal failed: %v", err)
+	}
+	t := &TaskDef{baseDir: baseDir}
+	if err := yaml.Unmarshal(bs, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -1,6 +1,7 @@
 package variant
 
 import (
+	"context"
 	"github.com/mumoshu/variant/pkg/util/stringutil"
 	"os"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"fmt"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 )
 
@@ -87,7 +89,7 @@ func (t TaskRunner) GenerateAutoenvRecursively(path string, env map[string]inter
 	return result, nil
 }
 
-func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (string, error) {
+func (t *TaskRunner) Run(runCtx context.Context, project *Application, asInput bool, caller ...*Task) (string, error) {
 	var ctx *log.Entry
 
 	if len(caller) > 0 {
@@ -98,16 +100,31 @@ func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (s
 
 	ctx.Debugf("task %s started", t.Name.String())
 
-	var output StepStringOutput
-	var lastout StepStringOutput
-	var err error
+	parentCtx := runCtx
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, t.Timeout)
+		defer cancel()
+	}
 
-	context := NewStepExecutionContext(*project, *t, t.Template, asInput, append(append([]*Task{t.Task}, caller...)))
+	context := NewStepExecutionContext(runCtx, *project, *t, t.Template, asInput, append([]*Task{t.Task}, caller...))
 
 	if t.TaskDef.fun != nil {
 		return t.TaskDef.fun(context)
 	}
 
+	// Evaluated before autoenv so that a skipped task doesn't leave its inputs in the environment
+	if t.When != "" {
+		ok, err := evaluateWhen(t.When, context)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed evaluating `when` of task %s", t.Name.ShortString())
+		}
+		if !ok {
+			context.taskLogger().Infof("task %s skipped as `when` evaluated to false", t.Name.ShortString())
+			return "", nil
+		}
+	}
+
 	if context.Autoenv() {
 		autoEnvVars, err := context.GenerateAutoenv()
 		if err != nil {
@@ -118,16 +135,139 @@ func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (s
 		}
 	}
 
-	for _, s := range t.Steps {
-		lastout, err = s.Run(context)
+	if err := t.runNeeds(context, project); err != nil {
+		return "", err
+	}
 
+	var checksum string
+	if len(t.Sources) > 0 || len(t.Generates) > 0 {
+		var upToDate bool
+		var err error
+		checksum, upToDate, err = t.upToDate(context, project.Force)
 		if err != nil {
-			return lastout.String, errors.Wrap(err, "Task#Run failed while running a script")
+			return "", errors.Wrapf(err, "failed checking if task %s is up to date", t.Name.ShortString())
+		}
+		if upToDate {
+			context.taskLogger().Infof("task %s is up to date", t.Name.ShortString())
+			return "", nil
 		}
+	}
+
+	var output, failedStep string
+	var err error
 
-		if s.GetName() != "" {
-			context = context.WithAdditionalValues(map[string]interface{}{s.GetName(): lastout.String})
+	if t.Retry != nil {
+		output, err = t.Retry.Do(runCtx, context.taskLogger(), func() (string, error) {
+			var out string
+			var err error
+			out, failedStep, err = runSteps(t.Steps, context)
+			return out, err
+		})
+	} else {
+		output, failedStep, err = runSteps(t.Steps, context)
+	}
+
+	if err != nil && t.Timeout > 0 && deadlineExceeded(runCtx) && !deadlineExceeded(parentCtx) {
+		if _, ok := errors.Cause(err).(TimeoutError); !ok {
+			err = errors.Wrap(newTimeoutError(fmt.Sprintf("task %s", t.Name.ShortString()), t.Timeout), err.Error())
 		}
+	}
+
+	// Steps run after the main steps should run even after the task is interrupted, hence the detached context.
+	// They run in the order of onFailure, cleanup and finally. cleanup runs only when the task is interrupted,
+	// whereas finally always runs, so a task interrupted by a signal runs both
+	after := context
+	if runCtx.Err() != nil {
+		after = context.detached()
+	}
+
+	// Exposes the failure to the templates as `.failure.error` and `.failure.step`. It is nil on success
+	var failure interface{}
+	if err != nil {
+		failure = map[string]interface{}{
+			"error": err.Error(),
+			"step":  failedStep,
+		}
+	}
+	after = after.WithAdditionalValues(map[string]interface{}{"failure": failure})
+
+	if err != nil {
+		if len(t.OnFailure) > 0 {
+			ctx.Debugf("task %s failed. running onFailure steps", t.Name.String())
+			if _, _, onFailureErr := runSteps(t.OnFailure, after); onFailureErr != nil {
+				err = multierror.Append(err, errors.Wrap(onFailureErr, "onFailure failed"))
+			}
+		}
+	}
+
+	if runCtx.Err() != nil && len(t.Cleanup) > 0 {
+		ctx.Debugf("task %s was interrupted. running cleanup steps", t.Name.String())
+		if _, _, cleanupErr := runSteps(t.Cleanup, after); cleanupErr != nil {
+			err = multierror.Append(err, errors.Wrap(cleanupErr, "cleanup failed"))
+		}
+	}
+
+	if len(t.Finally) > 0 {
+		ctx.Debugf("task %s running finally steps", t.Name.String())
+		if _, _, finallyErr := runSteps(t.Finally, after); finallyErr != nil {
+			err = multierror.Append(err, errors.Wrap(finallyErr, "finally failed"))
+		}
+	}
+
+	if err == nil && checksum != "" {
+		if err := writeChecksum(t.Name, checksum); err != nil {
+			context.taskLogger().Warnf("failed recording checksum of sources: %v", err)
+		}
+	}
+
+	ctx.Debugf("task %s finished. out=%v, err=%v", t.Name.String(), output, err)
+
+	return output, err
+}
+
+// upToDate returns the checksum of the sources, and true when all the generated files exist and the sources haven't changed since the last successful run
+func (t *TaskRunner) upToDate(context ExecutionContext, force bool) (string, bool, error) {
+	script, err := context.Render(t.Script, "script")
+	if err != nil {
+		return "", false, err
+	}
+
+	checksum, err := sourcesChecksum(t.Sources, script, t.stepDefs, t.Values)
+	if err != nil {
+		return "", false, err
+	}
+
+	if force {
+		return checksum, false, nil
+	}
+
+	exist, err := generatesExist(t.Generates)
+	if err != nil || !exist {
+		return checksum, false, err
+	}
+
+	last, err := readChecksum(t.Name)
+	if err != nil {
+		return checksum, false, err
+	}
+
+	return checksum, last == checksum, nil
+}
+
+// runSteps runs the steps in order, and returns the name of the failed step along with the error if any
+func runSteps(steps []Step, context ExecutionContext) (string, string, error) {
+	var output StepStringOutput
+	var lastout StepStringOutput
+	var err error
+
+	for _, s := range steps {
+		lastout, err = s.Run(context)
+
+		if err != nil {
+			return lastout.String, s.GetName(), errors.Wrap(err, "Task#Run failed while running a script")
+		}
+
+		context = context.withStepOutput(s, lastout)
 
 		if !s.Silenced() && len(lastout.String) > 0 {
 			var sep string
@@ -135,7 +275,7 @@ func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (s
 				sep = "\n"
 			}
 			output = StepStringOutput{
-				output.String + sep + lastout.String,
+				String: output.String + sep + lastout.String,
 			}
 		}
 	}
@@ -143,11 +283,5 @@ func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (s
 		output = lastout
 	}
 
-	if err != nil {
-		err = errors.Wrap(err, "Task#Run failed while running a script")
-	}
-
-	ctx.Debugf("task %s finished. out=%v, err=%v", t.Name.String(), output, err)
-
-	return output.String, err
+	return output.String, "", nil
 }
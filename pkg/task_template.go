@@ -2,13 +2,16 @@ package variant
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/Masterminds/sprig"
 	"github.com/mumoshu/variant/pkg/util/maputil"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
 type TaskTemplate struct {
@@ -67,12 +70,18 @@ func (f *TaskTemplate) createFuncMap() template.FuncMap {
 	return fns
 }
 
-func (t *TaskTemplate) Render(expr string, name string) (string, error) {
+func (t *TaskTemplate) newTemplate(name string) *template.Template {
 	task := t.task
 	tmpl := template.New(fmt.Sprintf("%s.definition.yaml: %s.%s.script", task.ProjectName, name, task.Name.ShortString()))
 	tmpl.Option("missingkey=error")
 
-	tmpl, err := tmpl.Funcs(sprig.HermeticTxtFuncMap()).Funcs(t.createFuncMap()).Parse(expr)
+	return tmpl.Funcs(sprig.HermeticTxtFuncMap()).Funcs(t.createFuncMap())
+}
+
+func (t *TaskTemplate) Render(expr string, name string) (string, error) {
+	task := t.task
+
+	tmpl, err := t.newTemplate(name).Parse(expr)
 	if err != nil {
 		log.Errorf("Error: %v", err)
 	}
@@ -85,6 +94,114 @@ func (t *TaskTemplate) Render(expr string, name string) (string, error) {
 	return buff.String(), nil
 }
 
+// RenderValue renders the expression into a value, so that arrays and maps can be passed around without being flattened into strings.
+// An expression consisting of a single action like `{{ .items }}` evaluates to the value of the action as-is.
+// Otherwise the rendered string is parsed as YAML.
+func (t *TaskTemplate) RenderValue(expr string, name string) (interface{}, error) {
+	task := t.task
+
+	tmpl, err := t.newTemplate(name).Parse(expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing %s.%s.%s", task.ProjectName, task.Name.ShortString(), name)
+	}
+
+	if nodes := tmpl.Tree.Root.Nodes; len(nodes) == 1 {
+		if action, ok := nodes[0].(*parse.ActionNode); ok && len(action.Pipe.Decl) == 0 {
+			// The value is passed through JSON, which is also valid YAML, so that it can be parsed back as-is.
+			// The helper has its own name so that it isn't affected by the functions available to users
+			tmpl, err = t.newTemplate(name).Funcs(template.FuncMap{"renderedValue": toJson}).Parse(fmt.Sprintf("{{ %s | renderedValue }}", action.Pipe))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed parsing %s.%s.%s", task.ProjectName, task.Name.ShortString(), name)
+			}
+		}
+	}
+
+	var buff bytes.Buffer
+	if err := tmpl.Execute(&buff, t.values); err != nil {
+		return nil, errors.Wrapf(err, "failed rendering %s.%s.%s", task.ProjectName, task.Name.ShortString(), name)
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal(buff.Bytes(), &value); err != nil {
+		return nil, errors.Wrapf(err, "failed parsing rendered %s.%s.%s: %s", task.ProjectName, task.Name.ShortString(), name, buff.String())
+	}
+
+	return maputil.RecursivelyStringifyKeysOfAny(value)
+}
+
+// ReferencedValues returns the values referenced from the expression like `.env="prd"`, in the order of appearance.
+// Fields within `range` and `with` are skipped as they aren't relative to the values
+func (t *TaskTemplate) ReferencedValues(expr string, name string) ([]string, error) {
+	tmpl, err := t.newTemplate(name).Parse(expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing %s.%s.%s", t.task.ProjectName, t.task.Name.ShortString(), name)
+	}
+
+	fields := [][]string{}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.FieldNode:
+			fields = append(fields, n.Ident)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		}
+	}
+	walk(tmpl.Tree.Root)
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, f := range fields {
+		path := "." + strings.Join(f, ".")
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		v, err := maputil.GetValueAtPath(t.values, f)
+		if err != nil {
+			continue
+		}
+		var formatted string
+		if bs, err := json.Marshal(v); err == nil {
+			formatted = string(bs)
+		} else {
+			formatted = fmt.Sprintf("%v", v)
+		}
+		result = append(result, fmt.Sprintf("%s=%s", path, formatted))
+	}
+
+	return result, nil
+}
+
 func (t *TaskTemplate) WithAdditionalValues(vs map[string]interface{}) *TaskTemplate {
 	newVals := map[string]interface{}{}
 	for k, v := range t.values {
@@ -197,6 +197,11 @@ func (c templateContext) toFlags(val interface{}) (string, error) {
 }
 
 func (c templateContext) validate(schema interface{}, doc interface{}) error {
+	return validateJSONSchema(schema, doc)
+}
+
+// validateJSONSchema returns an error listing every violation when the doc doesn't conform to the JSON schema
+func validateJSONSchema(schema interface{}, doc interface{}) error {
 	schemaLoader := gojsonschema.NewGoLoader(schema)
 	s, err := gojsonschema.NewSchema(schemaLoader)
 	if err != nil {
@@ -0,0 +1,41 @@
+package variant
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderValue(t *testing.T) {
+	task := &Task{Name: TaskName{Components: []string{"app", "render"}}}
+	tmpl := NewTaskTemplate(task, map[string]interface{}{
+		"items": []interface{}{"a", "b"},
+		"count": 2,
+		"config": map[string]interface{}{
+			"env": "prd",
+		},
+	})
+
+	testcases := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{expr: "{{ .items }}", expected: []interface{}{"a", "b"}},
+		{expr: "{{ .config }}", expected: map[string]interface{}{"env": "prd"}},
+		{expr: "{{ index .items 1 }}", expected: "b"},
+		{expr: `{{ "a | b" | upper }}`, expected: "A | B"},
+		{expr: "{{ .count }}", expected: 2},
+		{expr: "count: {{ .count }}", expected: map[string]interface{}{"count": 2}},
+	}
+
+	for i, tc := range testcases {
+		actual, err := tmpl.RenderValue(tc.expr, "test")
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := cmp.Diff(tc.expected, actual); diff != "" {
+			t.Errorf("%d: unexpected value for %s (-want +got):\n%s", i, tc.expr, diff)
+		}
+	}
+}
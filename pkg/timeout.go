@@ -0,0 +1,46 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimeoutExitStatus is the exit status of variant when a task timed out. Same as the one of `timeout` in GNU coreutils
+const TimeoutExitStatus = 124
+
+// TimeoutError is returned when a task or a script didn't finish within its timeout
+type TimeoutError struct {
+	error
+	Timeout time.Duration
+}
+
+func newTimeoutError(what string, timeout time.Duration) TimeoutError {
+	return TimeoutError{
+		error:   fmt.Errorf("%s timed out after %s", what, timeout),
+		Timeout: timeout,
+	}
+}
+
+func deadlineExceeded(ctx context.Context) bool {
+	return ctx.Err() == context.DeadlineExceeded
+}
+
+func parseTimeout(v interface{}) (time.Duration, error) {
+	switch t := v.(type) {
+	case string:
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return 0, errors.Wrapf(err, "field \"timeout\" must be a duration like \"10m\"")
+		}
+		return d, nil
+	case int:
+		return time.Duration(t) * time.Second, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("field \"timeout\" must be a duration like \"10m\" but it wasn't: %v", v)
+	}
+}
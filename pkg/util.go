@@ -1,7 +1,9 @@
 package variant
 
 import (
+	"github.com/hashicorp/go-multierror"
 	"github.com/mumoshu/variant/pkg/util/maputil"
+	"github.com/pkg/errors"
 	"log"
 	"reflect"
 )
@@ -34,3 +36,15 @@ func getOrDefault(nillable interface{}, kind reflect.Kind, defValue interface{})
 	}
 	return defValue
 }
+
+// rootCause is like errors.Cause, but also looks into the first of aggregated errors
+func rootCause(err error) error {
+	for {
+		err = errors.Cause(err)
+		merr, ok := err.(*multierror.Error)
+		if !ok || len(merr.Errors) == 0 {
+			return err
+		}
+		err = merr.Errors[0]
+	}
+}
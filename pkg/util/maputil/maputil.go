@@ -192,6 +192,11 @@ func RecursivelyStringifyKeys(m interface{}) (map[string]interface{}, error) {
 	return nil, fmt.Errorf("bug: unexpected type of m: %T", mm)
 }
 
+// RecursivelyStringifyKeysOfAny is the same as RecursivelyStringifyKeys, except that it accepts arrays and scalars as well
+func RecursivelyStringifyKeysOfAny(m interface{}) (interface{}, error) {
+	return _recursivelyStringifyKeys(m)
+}
+
 func _recursivelyStringifyKeys(m interface{}) (interface{}, error) {
 	switch src := m.(type) {
 	case map[string]interface{}:
@@ -1,6 +1,7 @@
 package variant
 
 import (
+	"context"
 	"fmt"
 	"github.com/juju/errors"
 	"github.com/mumoshu/variant/pkg/cli/env"
@@ -9,6 +10,7 @@ import (
 	"github.com/spf13/viper"
 	"os"
 	"strings"
+	"sync"
 )
 
 type CobraApp struct {
@@ -17,6 +19,13 @@ type CobraApp struct {
 }
 
 func (a *CobraApp) Run(args []string) (map[string]string, error) {
+	return a.RunContext(context.Background(), args)
+}
+
+// RunContext runs the command. Running tasks are terminated once the context is done
+func (a *CobraApp) RunContext(ctx context.Context, args []string) (map[string]string, error) {
+	a.VariantApp.runCtx = ctx
+
 	c := a.cobraCmd
 
 	c.SetArgs(append([]string{}, args...))
@@ -108,14 +117,19 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 	taskRegistry.RegisterTasks(rootTask)
 
 	inputResolver := NewRegistryBasedInputResolver(taskRegistry, taskNamer)
-	inputResolver.ResolveInputs()
+	if err := inputResolver.ResolveInputs(); err != nil {
+		return nil, NewInitError(err)
+	}
+
+	if err := resolveNeeds(taskRegistry, taskNamer); err != nil {
+		return nil, NewInitError(err)
+	}
 
 	v := viper.GetViper()
 
 	p := &Application{
 		Name:                commandName,
 		CommandRelativePath: commandPath,
-		CachedTaskOutputs:   map[string]interface{}{},
 		Env:                 envFromFile,
 		TaskNamer:           taskNamer,
 		TaskRegistry:        taskRegistry,
@@ -123,6 +137,8 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 		Viper:               v,
 		Log:                 log,
 		CommandName:         commandName,
+		mutex:               &sync.Mutex{},
+		memo:                newTaskMemo(),
 	}
 
 	adapter := NewCobraAdapter(p)
@@ -146,6 +162,12 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 	rootCmd.PersistentFlags().BoolVar(&(p.LogToStderr), "logtostderr", true, "write log messages to stderr")
 	rootCmd.PersistentFlags().StringArrayVarP(&(p.ConfigContexts), "config-context", "x", []string{}, "Config context")
 	rootCmd.PersistentFlags().StringArrayVarP(&(p.ConfigDirs), "config-dir", "d", []string{}, "Config dir")
+	rootCmd.PersistentFlags().IntVar(&(p.Parallelism), "parallelism", 1, "Max number of tasks run concurrently to resolve inputs")
+	rootCmd.PersistentFlags().BoolVar(&(p.NoCache), "no-cache", false, "Run tasks without reusing their outputs cached on disk")
+	rootCmd.PersistentFlags().BoolVar(&(p.Force), "force", false, "Run tasks even when their generated files are up to date")
+	rootCmd.PersistentFlags().BoolVar(&(p.Yes), "yes", false, "Assume yes to every confirmation, so that dangerous tasks can run non-interactively")
+	rootCmd.PersistentFlags().BoolVar(&(p.PrintEnv), "print-env", false, "Print the environment variables each script receives before running it")
+	rootCmd.PersistentFlags().DurationVar(&(p.GracePeriod), "grace-period", DefaultGracePeriod, "Duration to wait for scripts to exit after being interrupted, before killing them")
 
 	rootCmd.PersistentFlags().StringVarP(&(p.LogLevel), "log-level", "", "info", "Log level. One of: panic|fatal|error|warn|info|debug|trace")
 	rootCmd.PersistentFlags().StringVarP(&(p.LogColorPanic), "log-color-panic", "", "red", "Log message color: panic")
@@ -0,0 +1,59 @@
+package variant
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WhenStep runs the step only when the `when` template evaluates to a truthy value
+type WhenStep struct {
+	Step
+	When string
+}
+
+func withWhen(s Step, config StepDef) (Step, error) {
+	switch when := config.Get("when").(type) {
+	case string:
+		return WhenStep{Step: s, When: when}, nil
+	case bool:
+		return WhenStep{Step: s, When: fmt.Sprintf("%t", when)}, nil
+	case nil:
+		return s, nil
+	default:
+		return nil, fmt.Errorf("field \"when\" of step %q must be a template expression but it wasn't: %v", config.GetName(), when)
+	}
+}
+
+func (s WhenStep) Run(context ExecutionContext) (StepStringOutput, error) {
+	ok, err := evaluateWhen(s.When, context)
+	if err != nil {
+		return StepStringOutput{String: "when error"}, errors.Wrapf(err, "failed evaluating `when` of step %q", s.GetName())
+	}
+
+	if !ok {
+		context.taskLogger().Infof("step %s skipped as `when` evaluated to false", s.GetName())
+		return StepStringOutput{}, nil
+	}
+
+	return s.Step.Run(context)
+}
+
+func evaluateWhen(when string, context ExecutionContext) (bool, error) {
+	rendered, err := context.Render(when, "when")
+	if err != nil {
+		return false, err
+	}
+
+	return isTruthy(rendered), nil
+}
+
+// isTruthy returns false for an empty string and the strings commonly meant to be false, and true otherwise
+func isTruthy(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "0", "no", "off", "null", "nil", "<no value>":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package variant
+
+import (
+	"testing"
+)
+
+func TestIsTruthy(t *testing.T) {
+	testcases := map[string]bool{
+		"":           false,
+		" ":          false,
+		"false":      false,
+		"False":      false,
+		"0":          false,
+		"no":         false,
+		"off":        false,
+		"<no value>": false,
+		"true":       true,
+		"1":          true,
+		"prd":        true,
+	}
+
+	for s, expected := range testcases {
+		if actual := isTruthy(s); actual != expected {
+			t.Errorf("unexpected result for %q: expected %v, got %v", s, expected, actual)
+		}
+	}
+}
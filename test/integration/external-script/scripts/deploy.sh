@@ -0,0 +1,4 @@
+#!/usr/bin/env bash
+set -eu
+
+echo "deploying to {{ .env }}"
@@ -0,0 +1,3 @@
+#!/usr/bin/env bash
+# Not rendered, so that the braces reach the script as-is
+echo "{{ .not_a_template }}"